@@ -0,0 +1,73 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var buildDir = flag.String("build-dir", "", "`directory` that relative positions in the entries of a .tar or .tar.gz input are resolved against, unless the archive's manifest.json names one (default the current directory)")
+
+// manifestName is the archive entry mapping the names of the other entries
+// to the directory each was built in, as a JSON object. It must precede the
+// entries it describes.
+const manifestName = "manifest.json"
+
+// isArchive reports whether the input file name is a tar archive of logs.
+func isArchive(name string) bool {
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// readArchive reads and merges every log in the tar archive in, which is
+// gzip-compressed if name says so. Archives aren't cached with -cache.
+func readArchive(in io.Reader, name string) (*Result, error) {
+	if !strings.HasSuffix(name, ".tar") {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		in = zr
+	}
+
+	r := newResult()
+	dirs := make(map[string]string) // entry name -> build directory
+	tr := tar.NewReader(in)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return r, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if path.Base(h.Name) == manifestName {
+			if err := json.NewDecoder(tr).Decode(&dirs); err != nil {
+				return nil, fmt.Errorf("%s: %w", h.Name, err)
+			}
+			continue
+		}
+		dir, ok := dirs[h.Name]
+		if !ok {
+			dir = *buildDir
+		}
+		p, err := readStatsIn(tr, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", h.Name, err)
+		}
+		p.labelSkipped(name + "/" + h.Name)
+		r.mergeFile(p)
+	}
+}
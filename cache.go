@@ -0,0 +1,144 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	cachePath = flag.String("cache", "", "save the parsed input in `file` for -from-cache, and reuse it on later runs while the input file's size and modification time are unchanged")
+	fromCache = flag.String("from-cache", "", "analyze the parsed input saved in `file` by -cache instead of reading any input")
+)
+
+// cacheMagic begins every cache file. Bump the version whenever cacheEntry
+// changes incompatibly.
+const cacheMagic = "pgo-analysis cache v2\n"
+
+// cacheEntry is the gob-encoded contents of the -cache file.
+type cacheEntry struct {
+	// Identity of the input and the flags affecting parsing.
+	Size      int64
+	ModTime   time.Time
+	M         bool
+	Test2JSON bool
+
+	Stats      []CallStat
+	Inlined    map[string][]string
+	NotInlined map[string][]string
+	Parse      ParseStats
+}
+
+func (c *cacheEntry) matches(fi fs.FileInfo) bool {
+	return c.Size == fi.Size() && c.ModTime.Equal(fi.ModTime()) && c.M == *mFlag && c.Test2JSON == *test2json
+}
+
+// readStatsCached is readStats, using -cache if set and in is a regular
+// file.
+func readStatsCached(in *os.File) (*Result, error) {
+	if *cachePath == "" {
+		return readStats(in)
+	}
+	// Input that isn't a regular file, such as a pipe, can't be
+	// identified to reuse the cache automatically, but the cache is still
+	// written for use with -from-cache.
+	fi, err := in.Stat()
+	regular := err == nil && fi.Mode().IsRegular()
+	// A cached result has no skipped lines to log.
+	if regular && *logSkipped == "" {
+		c, err := loadCache(*cachePath)
+		if err == nil && c.matches(fi) {
+			return c.result(), nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Ignoring unreadable cache: %v", err)
+		}
+	}
+
+	r, err := readStats(in)
+	if err != nil {
+		return nil, err
+	}
+	if truncated.Load() || interrupted.Load() {
+		// Don't save incomplete input for reuse.
+		return r, nil
+	}
+	c := &cacheEntry{
+		M:          *mFlag,
+		Test2JSON:  *test2json,
+		Stats:      r.Stats,
+		Inlined:    r.Inlined,
+		NotInlined: r.NotInlined,
+		Parse:      r.Parse,
+	}
+	if regular {
+		c.Size = fi.Size()
+		c.ModTime = fi.ModTime()
+	}
+	if err := writeCache(*cachePath, c); err != nil {
+		log.Printf("Failed to write cache: %v", err)
+	}
+	return r, nil
+}
+
+func (c *cacheEntry) result() *Result {
+	return &Result{
+		Stats:      c.Stats,
+		Inlined:    c.Inlined,
+		NotInlined: c.NotInlined,
+		Parse:      c.Parse,
+	}
+}
+
+// readFromCache returns the result saved in the -from-cache file.
+func readFromCache() (*Result, error) {
+	c, err := loadCache(*fromCache)
+	if err != nil {
+		return nil, err
+	}
+	return c.result(), nil
+}
+
+func loadCache(path string) (*cacheEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(cacheMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != cacheMagic {
+		return nil, fmt.Errorf("%s is not a pgo-analysis cache, or is from an incompatible version", path)
+	}
+	var c cacheEntry
+	if err := gob.NewDecoder(f).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func writeCache(path string, c *cacheEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, cacheMagic); err != nil {
+		f.Close()
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(c); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
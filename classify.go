@@ -0,0 +1,85 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var classifyRules = flag.String("classify", "", "label callsites using the rules in `file` and print totals by label; each line is \"REGEXP LABEL\", matched against the package path, and the first matching rule wins")
+
+// unclassified labels callsites matching no -classify rule.
+const unclassified = "other"
+
+// loadClassifier returns a Classifier for the -classify rules file. Blank
+// lines and lines starting with # are ignored.
+func loadClassifier(path string) (func(CallStat) string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	type rule struct {
+		re    *regexp.Regexp
+		label string
+	}
+	var rules []rule
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("%s:%d: want REGEXP LABEL", path, i+1)
+		}
+		re, err := regexp.Compile(f[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		rules = append(rules, rule{re, f[1]})
+	}
+	return func(s CallStat) string {
+		for _, r := range rules {
+			if r.re.MatchString(s.Pkg) {
+				return r.label
+			}
+		}
+		return unclassified
+	}, nil
+}
+
+// printClasses prints a table of indirect call totals for each -classify
+// label, heaviest first.
+func printClasses(w io.Writer, r *Result) {
+	labels := make([]string, 0, len(r.classes))
+	for label := range r.classes {
+		labels = append(labels, label)
+	}
+	indirectWeight := func(c *Result) int64 { return c.weight.indirectFunc + c.weight.indirectMethod }
+	sort.Slice(labels, func(i, j int) bool {
+		wi, wj := indirectWeight(r.classes[labels[i]]), indirectWeight(r.classes[labels[j]])
+		if wi != wj {
+			return wi > wj
+		}
+		return labels[i] < labels[j]
+	})
+
+	fmt.Fprintf(w, "\nIndirect calls by class:\n")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\tClass\tCalls\tWeight\tDevirtualized\tDevirtualized weight\t\n")
+	for _, label := range labels {
+		c := r.classes[label]
+		devirtualized := c.devirtualizedWeight.indirectFunc + c.devirtualizedWeight.indirectMethod
+		fmt.Fprintf(tw, "\t%s\t%d\t%s\t%d\t%s (%.2f%%)\t\n", label, c.count.indirectFunc+c.count.indirectMethod, units(indirectWeight(c)), c.devirtualizedCount.indirectFunc+c.devirtualizedCount.indirectMethod, units(devirtualized), pct(devirtualized, indirectWeight(c)))
+	}
+	tw.Flush()
+}
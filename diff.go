@@ -0,0 +1,290 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	baseline         = flag.String("baseline", "", "compare against the pgodebug log in this `file`")
+	ratioRegressions = flag.Bool("ratio-regressions", false, "with -baseline, list indirect callsites whose hottest callee share of weight dropped")
+	diffOnly         = flag.Bool("diff-only", false, "with -baseline, print only the comparison with the baseline, omitting the report on the current run")
+	diffPatch        = flag.Bool("diff-patch", false, "with -baseline, print each changed callsite in a unified-diff style, - for the baseline and + for the new state")
+	callTypeChanges  = flag.Bool("call-type-changes", false, "with -baseline, list callsites whose call type (direct, indirect func, or interface method) changed")
+)
+
+// diffThreshold is the -diff-threshold flag: a weight change, either
+// absolute or as a percentage of the baseline weight, below which a
+// callsite's change is noise.
+type diffThreshold struct {
+	value   float64
+	percent bool
+}
+
+func (t *diffThreshold) String() string {
+	if t.percent {
+		return strconv.FormatFloat(t.value, 'g', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(t.value, 'g', -1, 64)
+}
+
+func (t *diffThreshold) Set(v string) error {
+	num, percent := strings.CutSuffix(v, "%")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("bad threshold %q", v)
+	}
+	*t = diffThreshold{value: n, percent: percent}
+	return nil
+}
+
+// below reports whether the change from old to new weight is below t.
+func (t *diffThreshold) below(old, new int64) bool {
+	delta := float64(new - old)
+	if delta < 0 {
+		delta = -delta
+	}
+	if t.percent {
+		if old == 0 {
+			return new == 0
+		}
+		return delta*100/float64(old) < t.value
+	}
+	return delta < t.value
+}
+
+var diffNoise diffThreshold
+
+func init() {
+	flag.Var(&diffNoise, "diff-threshold", "with -baseline, omit from per-callsite comparisons the callsites whose devirtualization is unchanged and whose weight and hottest weight each changed by less than this `amount`, a weight or a percentage of the baseline weight such as 1%")
+}
+
+// noise reports whether the change to the callsite of p is below
+// -diff-threshold. Devirtualization changes are never noise.
+func (p callsitePair) noise() bool {
+	if diffNoise.value == 0 || p.old.Devirtualized != p.new.Devirtualized {
+		return false
+	}
+	return diffNoise.below(p.old.Weight, p.new.Weight) && diffNoise.below(p.old.HottestWeight, p.new.HottestWeight)
+}
+
+// readBaseline parses and summarizes the -baseline log, applying the same
+// filters as the main input.
+func readBaseline(path string, filters []filter) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	resetMaxLines()
+	r, err := readStats(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading baseline: %w", err)
+	}
+	if truncated.Load() {
+		log.Printf("Stopped reading baseline after -max-lines=%d lines; the comparison is truncated", *maxLines)
+	}
+	r.dedupInlined()
+	r.Stats = collapseInstantiations(applyMinPercentile(applyFilters(r.Stats, filters)))
+	normalizeWeights(r.Stats)
+	r.summarize()
+	return r, nil
+}
+
+// diffSections are the sections comparing against the baseline, printed
+// alone with -diff-only.
+var diffSections = map[string]bool{
+	"diff":              true,
+	"ratio-regressions": true,
+	"diff-patch":        true,
+	"call-type-changes": true,
+}
+
+// callsiteKey identifies the same callsite across runs.
+type callsiteKey struct {
+	Pkg    string
+	Pos    string
+	Caller string
+}
+
+func keyOf(s CallStat) callsiteKey {
+	return callsiteKey{
+		Pkg:    s.Pkg,
+		Pos:    normalizePos(s.Pos),
+		Caller: s.Caller,
+	}
+}
+
+// callsitePair is a callsite present in both the baseline and current runs.
+type callsitePair struct {
+	old, new CallStat
+}
+
+// matchBaseline returns the callsites present in both runs, in current run
+// order.
+func matchBaseline(r *Result) []callsitePair {
+	old := make(map[callsiteKey]CallStat, len(r.Baseline.Stats))
+	for _, s := range r.Baseline.Stats {
+		old[keyOf(s)] = s
+	}
+	var pairs []callsitePair
+	for _, s := range r.Stats {
+		if o, ok := old[keyOf(s)]; ok {
+			pairs = append(pairs, callsitePair{old: o, new: s})
+		}
+	}
+	return pairs
+}
+
+func printDiff(w io.Writer, r *Result) {
+	if r.Baseline == nil {
+		return
+	}
+
+	var gained, lost, retargeted int
+	for _, p := range matchBaseline(r) {
+		switch {
+		case p.old.Devirtualized == "" && p.new.Devirtualized != "":
+			gained++
+		case p.old.Devirtualized != "" && p.new.Devirtualized == "":
+			lost++
+		case p.old.Devirtualized != p.new.Devirtualized:
+			// Still devirtualized, but the profile shifted which
+			// callee is hottest.
+			retargeted++
+		}
+	}
+	old, cur := &r.Baseline.devirtualizedWeight, &r.devirtualizedWeight
+
+	fmt.Fprintf(w, "\nComparison with baseline %s:\n", displayPath(*baseline))
+	fmt.Fprintf(w, "\tNewly devirtualized callsites: %d\n", gained)
+	fmt.Fprintf(w, "\tNo longer devirtualized callsites: %d\n", lost)
+	fmt.Fprintf(w, "\tDevirtualized to a different target: %d\n", retargeted)
+	fmt.Fprintf(w, "\tDevirtualized weight: %s -> %s (%+d)\n", units(old.total()), units(cur.total()), cur.total()-old.total())
+}
+
+// printRatioRegressions lists indirect callsites that became more
+// polymorphic than in the baseline, which predicts future devirtualization
+// loss even when the devirtualization decision hasn't changed yet.
+func printRatioRegressions(w io.Writer, r *Result) {
+	if r.Baseline == nil {
+		return
+	}
+
+	type regression struct {
+		callsitePair
+		oldRatio, newRatio float64
+	}
+	var regressions []regression
+	for _, p := range matchBaseline(r) {
+		if p.old.Direct || p.new.Direct || p.noise() {
+			continue
+		}
+		oldRatio := pct(p.old.HottestWeight, p.old.Weight)
+		newRatio := pct(p.new.HottestWeight, p.new.Weight)
+		if newRatio < oldRatio {
+			regressions = append(regressions, regression{p, oldRatio, newRatio})
+		}
+	}
+	sort.SliceStable(regressions, func(i, j int) bool {
+		return regressions[i].oldRatio-regressions[i].newRatio > regressions[j].oldRatio-regressions[j].newRatio
+	})
+
+	fmt.Fprintf(w, "\nIndirect calls with falling hottest callee share vs baseline:\n")
+	for _, g := range regressions {
+		s := g.new
+		fmt.Fprintf(w, "\t%+.2f%% (%.2f%% -> %.2f%%) %-40s -> %-40s\t%s\n", g.newRatio-g.oldRatio, g.oldRatio, g.newRatio, s.Caller, s.Hottest, displayPos(s.Pos))
+	}
+	fmt.Fprintf(w, "%d of the matched indirect calls regressed\n", len(regressions))
+}
+
+// callType describes the kind of call at a callsite.
+func callType(s CallStat) string {
+	switch {
+	case s.Direct:
+		return "direct"
+	case s.Interface:
+		return "interface method"
+	default:
+		return "indirect func"
+	}
+}
+
+// printCallTypeChanges lists callsites whose call type changed since the
+// baseline, such as an interface call that a refactor turned into a direct
+// call.
+func printCallTypeChanges(w io.Writer, r *Result) {
+	if r.Baseline == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "\nCallsites whose call type changed vs baseline:\n")
+	var changed int
+	for _, p := range matchBaseline(r) {
+		oldType, newType := callType(p.old), callType(p.new)
+		if oldType == newType {
+			continue
+		}
+		changed++
+		fmt.Fprintf(w, "\t%s -> %s %-40s (weight %s)\t%s\n", oldType, newType, p.new.Caller, units(p.new.Weight), displayPos(p.new.Pos))
+	}
+	fmt.Fprintf(w, "%d of the matched callsites changed call type\n", changed)
+}
+
+// patchLine describes the state of a callsite for -diff-patch.
+func patchLine(s CallStat) string {
+	state := "not devirtualized"
+	if s.Devirtualized != "" {
+		state = "devirtualized to " + s.Devirtualized
+	}
+	return fmt.Sprintf("%s, weight %s, hottest %s weight %s", state, units(s.Weight), s.Hottest, units(s.HottestWeight))
+}
+
+// printDiffPatch prints the callsites that changed since the baseline as
+// hunks of a unified diff, for reading in code review tools. Callsites
+// present in only one run have only a - or + line.
+func printDiffPatch(w io.Writer, r *Result) {
+	if r.Baseline == nil {
+		return
+	}
+
+	old := make(map[callsiteKey]CallStat, len(r.Baseline.Stats))
+	for _, s := range r.Baseline.Stats {
+		old[keyOf(s)] = s
+	}
+	seen := make(map[callsiteKey]bool, len(r.Stats))
+	fmt.Fprintf(w, "\n--- %s\n+++ current\n", displayPath(*baseline))
+	hunk := func(s CallStat) {
+		fmt.Fprintf(w, "@@ %s %s %s @@\n", s.Pkg, displayPos(s.Pos), s.Caller)
+	}
+	for _, s := range r.Stats {
+		k := keyOf(s)
+		seen[k] = true
+		o, ok := old[k]
+		switch {
+		case !ok:
+			hunk(s)
+			fmt.Fprintf(w, "+%s\n", patchLine(s))
+		case patchLine(o) != patchLine(s) && !(callsitePair{o, s}).noise():
+			hunk(s)
+			fmt.Fprintf(w, "-%s\n+%s\n", patchLine(o), patchLine(s))
+		}
+	}
+	for _, s := range r.Baseline.Stats {
+		if !seen[keyOf(s)] {
+			hunk(s)
+			fmt.Fprintf(w, "-%s\n", patchLine(s))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var expectFile = flag.String("expect", "", "exit with a failure status unless every callsite listed in `file` was devirtualized; each line is a callsite ID, as in -format=json, or PKG:POS:CALLER")
+
+var errExpectFailed = errors.New("expected devirtualizations missing")
+
+// checkExpected reports each -expect callsite that was not devirtualized,
+// returning errExpectFailed if there are any.
+func checkExpected(w io.Writer, r *Result) error {
+	b, err := os.ReadFile(*expectFile)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]CallStat)
+	byKey := make(map[callsiteKey]CallStat)
+	for _, s := range r.Stats {
+		// A callsite may appear more than once, e.g., from merged logs.
+		// Any devirtualization counts.
+		if old, ok := byKey[keyOf(s)]; ok && old.Devirtualized != "" {
+			continue
+		}
+		byID[callsiteID(s)] = s
+		byKey[keyOf(s)] = s
+	}
+
+	var failed int
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s, ok := byID[line]
+		if !ok {
+			// PKG:POS:CALLER. Positions contain colons themselves, but
+			// package paths and caller names don't.
+			first, last := strings.IndexByte(line, ':'), strings.LastIndexByte(line, ':')
+			if first < 0 || first == last {
+				return fmt.Errorf("%s:%d: want callsite ID or PKG:POS:CALLER", *expectFile, i+1)
+			}
+			s, ok = byKey[callsiteKey{Pkg: line[:first], Pos: normalizePos(line[first+1 : last]), Caller: line[last+1:]}]
+		}
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "expected devirtualization: %s: callsite not found\n", line)
+			failed++
+		case s.Devirtualized == "":
+			fmt.Fprintf(w, "expected devirtualization: %s: %s -> %s not devirtualized\n", line, s.Caller, s.Hottest)
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL: %d expected devirtualizations missing\n", failed)
+		return errExpectFailed
+	}
+	return nil
+}
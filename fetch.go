@@ -0,0 +1,198 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fetchers fetch input URLs, by scheme.
+var fetchers = map[string]func(u *url.URL) (io.ReadCloser, error){
+	"http":  fetchHTTP,
+	"https": fetchHTTP,
+	"s3":    fetchS3,
+}
+
+// isURL reports whether the input name is a URL that can be fetched.
+func isURL(name string) bool {
+	u, err := url.Parse(name)
+	return err == nil && fetchers[u.Scheme] != nil
+}
+
+// readURL fetches and reads the input at rawURL. Input is decompressed if it
+// is gzipped, regardless of its name. Fetched input isn't cached with -cache.
+func readURL(rawURL string) (*Result, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := fetchers[u.Scheme](u)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if isArchive(u.Path) {
+		return readArchive(body, u.Path)
+	}
+	br := bufio.NewReader(body)
+	var in io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		in = zr
+	}
+	return readStats(in)
+}
+
+func fetchHTTP(u *url.URL) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return do(req)
+}
+
+// do sends req, returning the response body if the request succeeded.
+func do(req *http.Request) (io.ReadCloser, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// awsCredentials are the credentials S3 requests are signed with.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string // optional
+}
+
+// fetchS3 fetches s3://BUCKET/KEY. Requests are signed with the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN environment
+// variables if set, and are otherwise anonymous, which only works for
+// public objects. The region is taken from AWS_REGION or AWS_DEFAULT_REGION.
+func fetchS3(u *url.URL) (io.ReadCloser, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", u.Host, region)
+	path := s3Escape(strings.TrimPrefix(u.Path, "/"))
+	req, err := http.NewRequest("GET", "https://"+host+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID != "" {
+		signS3(req, creds, region, "UNSIGNED-PAYLOAD", time.Now())
+	}
+	return do(req)
+}
+
+// s3Escape escapes an object key for a request path, as AWS signature
+// version 4 expects.
+func s3Escape(key string) string {
+	return awsEscape(key, "-._~/")
+}
+
+// awsEscape percent-encodes the bytes of s other than unreserved
+// characters and those in keep.
+func awsEscape(s, keep string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte(keep, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signS3 signs an S3 GET request with AWS signature version 4. payloadHash
+// is the hex SHA-256 of the request body, or UNSIGNED-PAYLOAD. All headers
+// of req, which must already be set, are signed.
+func signS3(req *http.Request, creds awsCredentials, region, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	signed := make([]string, 0, len(headers))
+	for k := range headers {
+		signed = append(signed, k)
+	}
+	sort.Strings(signed)
+
+	var query []string
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			query = append(query, awsEscape(k, "-._~")+"="+awsEscape(v, "-._~"))
+		}
+	}
+	sort.Strings(query)
+
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "GET\n%s\n%s\n", req.URL.EscapedPath(), strings.Join(query, "&"))
+	for _, k := range signed {
+		fmt.Fprintf(&canonical, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(signed, ";")
+	fmt.Fprintf(&canonical, "\n%s\n%s", signedHeaders, payloadHash)
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + creds.secretAccessKey)
+	for _, s := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	io.WriteString(h, data)
+	return h.Sum(nil)
+}
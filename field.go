@@ -0,0 +1,124 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var fieldFilter = flag.String("field-filter", "", "only analyze callsites matching `expr`, comparisons of CallStat fields joined by &&, e.g. \"Devirtualized!='' && DevirtualizedWeight>0\"")
+
+// parseFieldFilter returns the filter for a -field-filter expression:
+//
+//	expr  = cond { "&&" cond }
+//	cond  = field op value
+//	op    = "==" | "!=" | "<" | "<=" | ">" | ">="
+//	value = 'string' | "string" | integer | true | false
+//
+// field is the name of a CallStat field, and value must match its type.
+// String and bool fields may only be compared with == and !=.
+func parseFieldFilter(expr string) (filter, error) {
+	var conds []filter
+	for _, c := range strings.Split(expr, "&&") {
+		f, err := parseCond(strings.TrimSpace(c))
+		if err != nil {
+			return nil, fmt.Errorf("-field-filter %q: %v", expr, err)
+		}
+		conds = append(conds, f)
+	}
+	return func(s CallStat) bool {
+		for _, f := range conds {
+			if !f(s) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+var fieldOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseCond parses a single field op value comparison.
+func parseCond(cond string) (filter, error) {
+	i := strings.IndexAny(cond, "=!<>")
+	if i < 0 {
+		return nil, fmt.Errorf("%q: missing comparison", cond)
+	}
+	name := strings.TrimSpace(cond[:i])
+	var op string
+	for _, o := range fieldOps {
+		if strings.HasPrefix(cond[i:], o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("%q: bad comparison", cond)
+	}
+	value := strings.TrimSpace(cond[i+len(op):])
+
+	field, ok := reflect.TypeOf(CallStat{}).FieldByName(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+	get := func(s CallStat) reflect.Value {
+		return reflect.ValueOf(s).FieldByIndex(field.Index)
+	}
+
+	switch field.Type.Kind() {
+	case reflect.Int64:
+		want, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is an integer", name)
+		}
+		return func(s CallStat) bool {
+			return compare(op, get(s).Int(), want)
+		}, nil
+	case reflect.String:
+		if len(value) < 2 || value[0] != value[len(value)-1] || (value[0] != '\'' && value[0] != '"') {
+			return nil, fmt.Errorf("%s is a quoted string", name)
+		}
+		want := value[1 : len(value)-1]
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s is a string, which only supports == and !=", name)
+		}
+		return func(s CallStat) bool {
+			return (get(s).String() == want) == (op == "==")
+		}, nil
+	case reflect.Bool:
+		want, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s is true or false", name)
+		}
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s is a bool, which only supports == and !=", name)
+		}
+		return func(s CallStat) bool {
+			return (get(s).Bool() == want) == (op == "==")
+		}, nil
+	}
+	return nil, fmt.Errorf("can't compare field %q", name)
+}
+
+func compare(op string, a, b int64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	default: // ">="
+		return a >= b
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	posFlag          = flag.String("pos", "", "only analyze callsites in `FILE:START-END`, an inclusive line range of a file")
+	pkgFlag          = flag.String("pkg", "", "only analyze callsites in packages with this import path `prefix`")
+	pkgRegex         = flag.String("pkg-regex", "", "only analyze callsites in packages whose import path matches this `regexp`; use (?i) for case-insensitive matching")
+	callerFlag       = flag.String("caller", "", "only analyze callsites whose caller function matches this `regexp`, which may simply be a substring of the name")
+	hideWrappers     = flag.Bool("hide-wrappers", false, "ignore callsites in compiler-generated wrapper functions, those whose caller name matches -wrapper-pattern")
+	wrapperPattern   = flag.String("wrapper-pattern", `(-fm|-wrapper|\.(deferwrap|gowrap)\d+)$`, "`regexp` matching the caller names of compiler-generated wrappers for -hide-wrappers, such as method value (-fm) and go and defer statement wrappers")
+	excludeGenerated = flag.Bool("exclude-generated", false, "ignore callsites in generated files: *.pb.go, *_gen.go, and files whose first line contains \"Code generated\"")
+	minWeight        = flag.Int64("min-weight", 0, "only analyze callsites with at least this weight")
+	maxWeight        = flag.Int64("max-weight", 0, "if non-zero, only analyze callsites with at most this weight")
+	minPercentile    = flag.Float64("min-percentile", 0, "only analyze callsites with at least the weight of this `percentile` of the callsites passing the other filters; e.g., 90 keeps the heaviest tenth")
+)
+
+// filter reports whether a callsite should be included in the analysis.
+type filter func(s CallStat) bool
+
+// buildFilters returns the filters selected by flags.
+func buildFilters() ([]filter, error) {
+	var filters []filter
+	if *posFlag != "" {
+		f, err := posFilter(*posFlag)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	if *pkgFlag != "" {
+		prefix := *pkgFlag
+		filters = append(filters, func(s CallStat) bool {
+			return strings.HasPrefix(s.Pkg, prefix)
+		})
+	}
+	if *pkgRegex != "" {
+		re, err := regexp.Compile(*pkgRegex)
+		if err != nil {
+			return nil, fmt.Errorf("bad -pkg-regex: %v", err)
+		}
+		filters = append(filters, func(s CallStat) bool {
+			return re.MatchString(s.Pkg)
+		})
+	}
+	if *callerFlag != "" {
+		re, err := regexp.Compile(*callerFlag)
+		if err != nil {
+			return nil, fmt.Errorf("bad -caller: %v", err)
+		}
+		filters = append(filters, func(s CallStat) bool {
+			return re.MatchString(s.Caller)
+		})
+	}
+	if *hideWrappers {
+		re, err := regexp.Compile(*wrapperPattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad -wrapper-pattern: %v", err)
+		}
+		filters = append(filters, func(s CallStat) bool {
+			return !re.MatchString(s.Caller)
+		})
+	}
+	if *minPercentile < 0 || *minPercentile >= 100 {
+		return nil, fmt.Errorf("-min-percentile %g out of range [0, 100)", *minPercentile)
+	}
+	if *maxWeight > 0 && *minWeight > *maxWeight {
+		return nil, fmt.Errorf("-min-weight %d exceeds -max-weight %d", *minWeight, *maxWeight)
+	}
+	if *minWeight > 0 {
+		min := *minWeight
+		filters = append(filters, func(s CallStat) bool {
+			return s.Weight >= min
+		})
+	}
+	if *maxWeight > 0 {
+		max := *maxWeight
+		filters = append(filters, func(s CallStat) bool {
+			return s.Weight <= max
+		})
+	}
+	if *fieldFilter != "" {
+		f, err := parseFieldFilter(*fieldFilter)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	if *excludeGenerated {
+		generated := make(map[string]bool) // file -> is generated
+		filters = append(filters, func(s CallStat) bool {
+			file, _, ok := splitPos(normalizePos(s.Pos))
+			if !ok {
+				return true
+			}
+			g, ok := generated[file]
+			if !ok {
+				g = isGenerated(file)
+				generated[file] = g
+			}
+			return !g
+		})
+	}
+	return filters, nil
+}
+
+// isGenerated reports whether the source file at path appears to be
+// generated code. Files that can't be read are assumed not to be.
+func isGenerated(path string) bool {
+	if strings.HasSuffix(path, ".pb.go") || strings.HasSuffix(path, "_gen.go") {
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	return strings.Contains(line, "Code generated")
+}
+
+// applyFilters returns the stats that pass every filter.
+func applyFilters(stats []CallStat, filters []filter) []CallStat {
+	if len(filters) == 0 {
+		return stats
+	}
+	var kept []CallStat
+outer:
+	for _, s := range stats {
+		for _, f := range filters {
+			if !f(s) {
+				continue outer
+			}
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// applyMinPercentile returns the stats with at least the -min-percentile
+// weight. Unlike the other filters, the cutoff depends on the whole input,
+// so this applies after them.
+func applyMinPercentile(stats []CallStat) []CallStat {
+	if *minPercentile <= 0 || len(stats) == 0 {
+		return stats
+	}
+	weights := make([]float64, len(stats))
+	for i, s := range stats {
+		weights[i] = float64(s.Weight)
+	}
+	sort.Float64s(weights)
+	cutoff := exactQuantile(weights, *minPercentile/100)
+
+	var kept []CallStat
+	for _, s := range stats {
+		if float64(s.Weight) >= cutoff {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// splitPos splits a file:line:col position into its file and line.
+func splitPos(pos string) (file string, line int, ok bool) {
+	i := strings.LastIndexByte(pos, ':')
+	if i < 0 {
+		return "", 0, false
+	}
+	j := strings.LastIndexByte(pos[:i], ':')
+	if j < 0 {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(pos[j+1 : i])
+	if err != nil {
+		return "", 0, false
+	}
+	return pos[:j], line, true
+}
+
+// posFilter returns a filter for a -pos FILE:START-END spec.
+func posFilter(spec string) (filter, error) {
+	i := strings.LastIndexByte(spec, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("-pos %q: want FILE:START-END", spec)
+	}
+	file := normalizePos(spec[:i])
+	lo, hi, ok := strings.Cut(spec[i+1:], "-")
+	if !ok {
+		return nil, fmt.Errorf("-pos %q: want FILE:START-END", spec)
+	}
+	start, err := strconv.Atoi(lo)
+	if err != nil {
+		return nil, fmt.Errorf("-pos %q: bad start line: %v", spec, err)
+	}
+	end, err := strconv.Atoi(hi)
+	if err != nil {
+		return nil, fmt.Errorf("-pos %q: bad end line: %v", spec, err)
+	}
+	if start > end {
+		return nil, fmt.Errorf("-pos %q: start line after end line", spec)
+	}
+
+	return func(s CallStat) bool {
+		f, line, ok := splitPos(normalizePos(s.Pos))
+		return ok && f == file && line >= start && line <= end
+	}, nil
+}
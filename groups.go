@@ -0,0 +1,445 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// group aggregates the indirect callsites sharing a key, such as a package.
+type group struct {
+	name string
+
+	calls               int64 // number of indirect callsites
+	weight              int64
+	hottestWeight       int64
+	devirtualized       int64 // number of devirtualized callsites
+	devirtualizedWeight int64
+	missedWeight        int64 // weight of callsites not devirtualized
+}
+
+var minCallsites = flag.Int("min-callsites", 0, "omit groups with fewer than `K` indirect callsites from grouped tables")
+
+// groupIndirect aggregates the indirect callsites in stats by key, returning
+// the groups sorted by name. Groups smaller than -min-callsites are
+// omitted.
+func groupIndirect(stats []CallStat, key func(CallStat) string) []*group {
+	m := make(map[string]*group)
+	for _, s := range stats {
+		if s.Direct {
+			continue
+		}
+		k := key(s)
+		g, ok := m[k]
+		if !ok {
+			g = &group{name: k}
+			m[k] = g
+		}
+		g.calls++
+		g.weight += s.Weight
+		g.hottestWeight += s.HottestWeight
+		if s.Devirtualized != "" {
+			g.devirtualized++
+			g.devirtualizedWeight += s.DevirtualizedWeight
+		} else {
+			g.missedWeight += s.Weight
+		}
+	}
+
+	groups := make([]*group, 0, len(m))
+	for _, g := range m {
+		if g.calls >= int64(*minCallsites) {
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+func pkgOf(s CallStat) string { return s.Pkg }
+
+var (
+	undevirtualizedPackages  = flag.Bool("undevirtualized-packages", false, "list packages with indirect calls but no devirtualization at all")
+	undevirtualizedMinWeight = flag.Int64("undevirtualized-min-weight", 1, "minimum indirect call weight of a package listed by -undevirtualized-packages")
+)
+
+// printUndevirtualizedPackages lists packages where nothing was
+// devirtualized, heaviest first. These are likely the highest-leverage
+// targets.
+func printUndevirtualizedPackages(w io.Writer, r *Result) {
+	var missed []*group
+	for _, g := range groupIndirect(r.Stats, pkgOf) {
+		if g.devirtualizedWeight == 0 && g.weight >= *undevirtualizedMinWeight {
+			missed = append(missed, g)
+		}
+	}
+	sort.SliceStable(missed, func(i, j int) bool {
+		return missed[i].weight > missed[j].weight
+	})
+
+	indirectWeight := r.weight.indirectFunc + r.weight.indirectMethod
+	fmt.Fprintf(w, "\nPackages with no devirtualized calls:\n")
+	for _, g := range missed {
+		fmt.Fprintf(w, "\t%-60s weight %s (%.2f%% of indirect weight, %d calls)%s\n", g.name, units(g.weight), pct(g.weight, indirectWeight), g.calls, moduleTag(g.name))
+	}
+}
+
+var topCallees = flag.Int("callees", 0, "print the `N` indirect call targets receiving the most hottest callee weight across all callsites")
+
+func hottestOf(s CallStat) string { return s.Hottest }
+
+// printTopCallees lists the functions receiving the most indirect call
+// traffic program-wide, whether or not calls to them were devirtualized.
+func printTopCallees(w io.Writer, r *Result) {
+	groups := groupIndirect(r.Stats, hottestOf)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].hottestWeight > groups[j].hottestWeight
+	})
+
+	n := *topCallees
+	if n <= 0 {
+		n = defaultTopCount
+	}
+	hottestWeight := r.hottestWeight.indirectFunc + r.hottestWeight.indirectMethod
+	fmt.Fprintf(w, "\nTop %d hottest indirect call targets:\n", n)
+	printed := 0
+	for _, g := range groups {
+		if printed >= n {
+			break
+		}
+		if g.name == "" {
+			continue
+		}
+		fmt.Fprintf(w, "\t%-60s weight %s (%.2f%% of indirect hottest weight, %d callsites)\n", g.name, units(g.hottestWeight), pct(g.hottestWeight, hottestWeight), g.calls)
+		printed++
+	}
+}
+
+var polymorphicCallers = flag.Int("polymorphic-callers", 0, "print the `N` caller functions whose indirect calls have the most distinct hottest or devirtualized targets")
+
+// printPolymorphicCallers ranks callers by the number of distinct targets
+// of their indirect calls. Callers with many targets are polymorphism
+// hotspots whose design inherently defeats devirtualization, however much
+// weight they carry.
+func printPolymorphicCallers(w io.Writer, r *Result) {
+	type caller struct {
+		name    string
+		targets map[string]bool
+		weight  int64
+	}
+	m := make(map[string]*caller)
+	for _, s := range r.Stats {
+		if s.Direct {
+			continue
+		}
+		c, ok := m[s.Caller]
+		if !ok {
+			c = &caller{name: s.Caller, targets: make(map[string]bool)}
+			m[s.Caller] = c
+		}
+		for _, t := range []string{s.Hottest, s.Devirtualized} {
+			if t != "" {
+				c.targets[t] = true
+			}
+		}
+		c.weight += s.Weight
+	}
+	callers := make([]*caller, 0, len(m))
+	for _, c := range m {
+		callers = append(callers, c)
+	}
+	sort.Slice(callers, func(i, j int) bool {
+		if len(callers[i].targets) != len(callers[j].targets) {
+			return len(callers[i].targets) > len(callers[j].targets)
+		}
+		if callers[i].weight != callers[j].weight {
+			return callers[i].weight > callers[j].weight
+		}
+		return callers[i].name < callers[j].name
+	})
+	n := *polymorphicCallers
+	if n <= 0 {
+		n = defaultTopCount
+	}
+	if len(callers) > n {
+		callers = callers[:n]
+	}
+
+	fmt.Fprintf(w, "\nTop %d callers by distinct indirect call targets:\n", n)
+	for _, c := range callers {
+		fmt.Fprintf(w, "\t%-60s %d targets (weight %s)\n", c.name, len(c.targets), units(c.weight))
+	}
+}
+
+// groupKeys are the -group-by keys.
+var groupKeys = map[string]func(CallStat) string{
+	"package": pkgOf,
+	"caller":  func(s CallStat) string { return s.Caller },
+	"target":  hottestOf,
+	"file": func(s CallStat) string {
+		file, _, ok := splitPos(normalizePos(s.Pos))
+		if !ok {
+			return displayPos(s.Pos)
+		}
+		return displayPos(file)
+	},
+}
+
+var groupBy = flag.String("group-by", "", "print a table of indirect calls grouped by `key`: package, caller, target, or file")
+
+// printGroups prints the indirect call summary for each -group-by group,
+// heaviest first.
+func printGroups(w io.Writer, r *Result) {
+	key, ok := groupKeys[*groupBy]
+	if !ok {
+		return
+	}
+	groups := groupIndirect(r.Stats, key)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].weight > groups[j].weight
+	})
+
+	indirectWeight := r.weight.indirectFunc + r.weight.indirectMethod
+	fmt.Fprintf(w, "\nIndirect calls by %s:\n", *groupBy)
+	for _, g := range groups {
+		tag := ""
+		if *groupBy == "package" {
+			tag = moduleTag(g.name)
+		}
+		fmt.Fprintf(w, "\t%-60s weight %s (%.2f%% of indirect weight), %d calls, %d devirtualized (weight %s, %.2f%%)%s\n", g.name, units(g.weight), pct(g.weight, indirectWeight), g.calls, g.devirtualized, units(g.devirtualizedWeight), pct(g.devirtualizedWeight, g.weight), tag)
+	}
+}
+
+var byInterface = flag.Bool("by-interface", false, "list interface methods by the weight of calls to them that were not devirtualized")
+
+// interfaceMethodOf returns the name of the method called by an interface
+// call.
+//
+// The logs don't record the interface type itself, so this is derived from
+// the hottest (concrete) callee, e.g. "Read" for "os.(*File).Read". The
+// method name alone usually identifies the interface well enough (Read is
+// most likely io.Reader), but unrelated interfaces with the same method
+// name are merged.
+func interfaceMethodOf(s CallStat) string {
+	sym := s.Hottest
+	if sym == "" {
+		sym = s.Devirtualized
+	}
+	// Drop type arguments, which may contain dots.
+	sym = canonicalizeGeneric(sym)
+	if i := strings.LastIndexByte(sym, '.'); i >= 0 {
+		sym = sym[i+1:]
+	}
+	if sym == "" {
+		return "unknown"
+	}
+	return sym
+}
+
+// canonicalizeGeneric strips the type arguments from the name of a generic
+// function or method instantiation, such as "pkg.F[go.shape.int]" or
+// "pkg.(*T[go.shape.struct { x []int }]).M", leaving the name of the
+// generic function itself.
+func canonicalizeGeneric(sym string) string {
+	if strings.IndexByte(sym, '[') < 0 {
+		return sym
+	}
+	var b strings.Builder
+	depth := 0
+	for _, c := range sym {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+var collapseGenerics = flag.Bool("collapse-generics", false, "merge the callsites of all instantiations of a generic function, stripping type arguments from caller and callee names")
+
+// collapseInstantiations returns stats with the type arguments stripped from
+// function names, merging callsites that then become identical: the same
+// call in different instantiations of a generic function.
+func collapseInstantiations(stats []CallStat) []CallStat {
+	if !*collapseGenerics {
+		return stats
+	}
+	type key struct {
+		callsiteKey
+		hottest string
+	}
+	index := make(map[key]int)
+	var out []CallStat
+	for _, s := range stats {
+		s.Caller = canonicalizeGeneric(s.Caller)
+		s.Hottest = canonicalizeGeneric(s.Hottest)
+		s.Devirtualized = canonicalizeGeneric(s.Devirtualized)
+		k := key{keyOf(s), s.Hottest}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(out)
+			out = append(out, s)
+			continue
+		}
+		m := &out[i]
+		m.Weight += s.Weight
+		m.HottestWeight += s.HottestWeight
+		m.DevirtualizedWeight += s.DevirtualizedWeight
+		if m.Devirtualized == "" {
+			m.Devirtualized = s.Devirtualized
+		}
+	}
+	return out
+}
+
+// printByInterface lists interface methods, most missed weight first. Those
+// with high missed weight and few devirtualized calls are likely too
+// polymorphic to devirtualize, or lack profile data.
+func printByInterface(w io.Writer, r *Result) {
+	groups := groupIndirect(interfaceStats(r.Stats), interfaceMethodOf)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].missedWeight > groups[j].missedWeight
+	})
+
+	fmt.Fprintf(w, "\nInterface calls by method, most non-devirtualized weight first:\n")
+	for _, g := range groups {
+		fmt.Fprintf(w, "\t%-40s not devirtualized weight %s (%.2f%% of method weight), %d calls, %d devirtualized\n", g.name, units(g.missedWeight), pct(g.missedWeight, g.weight), g.calls, g.devirtualized)
+	}
+}
+
+var topPerInterface = flag.Int("top-per-interface", 0, "for each interface method, most non-devirtualized weight first, list its `N` hottest non-devirtualized calls")
+
+// printTopPerInterface prints a worklist of missed interface calls for each
+// interface method, as grouped by -by-interface.
+func printTopPerInterface(w io.Writer, r *Result) {
+	stats := interfaceStats(r.Stats)
+	groups := groupIndirect(stats, interfaceMethodOf)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].missedWeight > groups[j].missedWeight
+	})
+	byMethod := make(map[string][]CallStat)
+	for _, s := range sortedByHottest(stats) {
+		if s.Devirtualized == "" {
+			m := interfaceMethodOf(s)
+			byMethod[m] = append(byMethod[m], s)
+		}
+	}
+
+	n := *topPerInterface
+	if n <= 0 {
+		n = defaultTopCount
+	}
+	fmt.Fprintf(w, "\nTop %d non-devirtualized calls per interface method:\n", n)
+	for _, g := range groups {
+		missed := byMethod[g.name]
+		if len(missed) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s: not devirtualized weight %s, %d calls\n", g.name, units(g.missedWeight), len(missed))
+		// missed is sorted by increasing hottest weight.
+		for i := len(missed) - 1; i >= 0 && i >= len(missed)-n; i-- {
+			s := missed[i]
+			fmt.Fprintf(w, "\t\t%-40s -> %-40s (weight %s, %.2f%% of callsite weight)\t%s\n", s.Caller, s.Hottest, units(s.HottestWeight), hottestShare(s), displayPos(s.Pos))
+		}
+	}
+}
+
+var completeness = flag.Bool("completeness", false, "print each package's devirtualized share of interface call weight, least devirtualized first")
+
+// interfaceStats returns only the interface method calls in stats.
+func interfaceStats(stats []CallStat) []CallStat {
+	var ifaces []CallStat
+	for _, s := range stats {
+		if s.Interface {
+			ifaces = append(ifaces, s)
+		}
+	}
+	return ifaces
+}
+
+// printCompleteness prints how close each package is to having all of its
+// interface call weight devirtualized, worst first, to direct effort to the
+// packages with the most room to improve.
+func printCompleteness(w io.Writer, r *Result) {
+	groups := groupIndirect(interfaceStats(r.Stats), pkgOf)
+	// Packages with no interface call weight have no meaningful ratio.
+	kept := groups[:0]
+	for _, g := range groups {
+		if g.weight > 0 {
+			kept = append(kept, g)
+		}
+	}
+	groups = kept
+	sort.SliceStable(groups, func(i, j int) bool {
+		return pct(groups[i].devirtualizedWeight, groups[i].weight) < pct(groups[j].devirtualizedWeight, groups[j].weight)
+	})
+
+	fmt.Fprintf(w, "\nPackage devirtualization completeness (devirtualized share of interface weight):\n")
+	for _, g := range groups {
+		fmt.Fprintf(w, "\t%6.2f%% %-60s (weight %s, %d calls)%s\n", pct(g.devirtualizedWeight, g.weight), g.name, units(g.weight), g.calls, moduleTag(g.name))
+	}
+}
+
+var crossPackage = flag.Bool("cross-package", false, "list devirtualized calls whose target is in a different package than the caller")
+
+// symbolPkg returns the package path of a function symbol, such as
+// "example.com/bar" for "example.com/bar.(*T[example.com/baz.U]).M".
+func symbolPkg(sym string) string {
+	sym = canonicalizeGeneric(sym)
+	slash := strings.LastIndexByte(sym, '/') + 1
+	dot := strings.IndexByte(sym[slash:], '.')
+	if dot < 0 {
+		return ""
+	}
+	return sym[:slash+dot]
+}
+
+// samePackage reports whether symbol package sym is package path pkg.
+// Symbols may be qualified by package name rather than path, which is
+// matched against the last element of the path.
+func samePackage(sym, pkg string) bool {
+	if sym == pkg {
+		return true
+	}
+	return !strings.Contains(sym, "/") && sym == pkg[strings.LastIndexByte(pkg, '/')+1:]
+}
+
+// printCrossPackage lists devirtualized calls to a target in another
+// package, heaviest first. Cross-package targets may not be inlinable
+// after devirtualization, e.g., because of export data limits, so these
+// devirtualizations may yield less benefit.
+func printCrossPackage(w io.Writer, r *Result) {
+	var cross []CallStat
+	var weight int64
+	for _, s := range r.Stats {
+		if s.Direct || s.Devirtualized == "" {
+			continue
+		}
+		if samePackage(symbolPkg(s.Devirtualized), s.Pkg) {
+			continue
+		}
+		cross = append(cross, s)
+		weight += s.DevirtualizedWeight
+	}
+	sort.SliceStable(cross, func(i, j int) bool {
+		return cross[i].DevirtualizedWeight > cross[j].DevirtualizedWeight
+	})
+
+	devirtualized := r.devirtualizedWeight.indirectFunc + r.devirtualizedWeight.indirectMethod
+	fmt.Fprintf(w, "\nDevirtualized calls to another package: %d, weight %s (%.2f%% of devirtualized weight)\n", len(cross), units(weight), pct(weight, devirtualized))
+	for _, s := range cross {
+		fmt.Fprintf(w, "\t%-40s -> %-40s (weight %s)\t%s\n", s.Caller, s.Devirtualized, units(s.DevirtualizedWeight), displayPos(s.Pos))
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalizeGeneric(t *testing.T) {
+	for _, tc := range []struct {
+		sym, want string
+	}{
+		{"pkg.F", "pkg.F"},
+		{"pkg.(*T).M", "pkg.(*T).M"},
+		{"pkg.F[go.shape.int]", "pkg.F"},
+		{"pkg.F[go.shape.int,go.shape.string]", "pkg.F"},
+		{"pkg.(*T[go.shape.struct { x []int }]).M", "pkg.(*T).M"},
+		{"pkg.T[go.shape.*uint8].M", "pkg.T.M"},
+		{"pkg.F[go.shape.map[string][]pkg.T[go.shape.int]]", "pkg.F"},
+		{"pkg.F[go.shape.int].func1", "pkg.F.func1"},
+		{"example.com/a/b.(*List[go.shape.interface { Len() int }]).Push", "example.com/a/b.(*List).Push"},
+	} {
+		if got := canonicalizeGeneric(tc.sym); got != tc.want {
+			t.Errorf("canonicalizeGeneric(%q) = %q, want %q", tc.sym, got, tc.want)
+		}
+	}
+}
+
+func TestCollapseInstantiations(t *testing.T) {
+	defer func(old bool) { *collapseGenerics = old }(*collapseGenerics)
+	*collapseGenerics = true
+
+	stats := []CallStat{
+		{Pkg: "pkg", Pos: "/src/a.go:5:2", Caller: "pkg.F[go.shape.int]", Interface: true, Weight: 30, Hottest: "pkg.(*T).M", HottestWeight: 20},
+		{Pkg: "pkg", Pos: "/src/a.go:5:2", Caller: "pkg.F[go.shape.string]", Interface: true, Weight: 10, Hottest: "pkg.(*T).M", HottestWeight: 5, Devirtualized: "pkg.(*T).M", DevirtualizedWeight: 5},
+		{Pkg: "pkg", Pos: "/src/a.go:9:2", Caller: "pkg.G", Weight: 7, Hottest: "pkg.h", HottestWeight: 7},
+	}
+	want := []CallStat{
+		{Pkg: "pkg", Pos: "/src/a.go:5:2", Caller: "pkg.F", Interface: true, Weight: 40, Hottest: "pkg.(*T).M", HottestWeight: 25, Devirtualized: "pkg.(*T).M", DevirtualizedWeight: 5},
+		{Pkg: "pkg", Pos: "/src/a.go:9:2", Caller: "pkg.G", Weight: 7, Hottest: "pkg.h", HottestWeight: 7},
+	}
+	if got := collapseInstantiations(stats); !reflect.DeepEqual(got, want) {
+		t.Errorf("collapseInstantiations:\ngot  %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+var header = flag.Bool("header", false, "describe how the report was generated (tool version, inputs, time, and flags) at the top of text output and in JSON output")
+
+// Metadata describes how a report was generated, so that archived reports
+// are self-describing.
+type Metadata struct {
+	Version string `json:",omitempty"` // omitted with -deterministic
+	Inputs  []string
+	Time    *time.Time `json:",omitempty"` // omitted with -deterministic
+	Flags   []string   // flags set on the command line
+
+	ProfileDate string `json:",omitempty"` // from -profile-date
+}
+
+var deterministic = flag.Bool("deterministic", false, "omit the generation time and tool version from output, print positions as with -relative-pos, and input and other file paths by base name, so output depends only on the input contents")
+
+var timestamp = flag.String("timestamp", "", "report generation time to record, in RFC 3339 format (default now); useful for reproducible output")
+
+var profileDate = flag.String("profile-date", "", "record this `date` the profile was collected, as 2006-01-02 or in RFC 3339 format, in the header and JSON output, to correlate archived reports with the profile's age")
+
+// checkProfileDate reports whether -profile-date is a valid date.
+func checkProfileDate() error {
+	if *profileDate == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.DateOnly, *profileDate); err == nil {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, *profileDate); err != nil {
+		return fmt.Errorf("bad -profile-date %q: want 2006-01-02 or RFC 3339 format", *profileDate)
+	}
+	return nil
+}
+
+// reportTime returns the time to record as the report generation time.
+func reportTime() (time.Time, error) {
+	if *timestamp == "" {
+		return time.Now(), nil
+	}
+	t, err := time.Parse(time.RFC3339, *timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad -timestamp: %v", err)
+	}
+	return t, nil
+}
+
+// displayPath returns the file path as it should be printed: by base name
+// under -deterministic, which must not depend on where files are.
+func displayPath(path string) string {
+	if *deterministic {
+		return filepath.Base(path)
+	}
+	return path
+}
+
+// inputNames returns the names of the input files, or "stdin".
+func inputNames() []string {
+	files := inputFiles()
+	if len(files) == 0 {
+		return []string{"stdin"}
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = displayPath(f)
+	}
+	return names
+}
+
+func buildMetadata() *Metadata {
+	m := &Metadata{}
+	if !*deterministic {
+		// -timestamp is validated at startup.
+		t, _ := reportTime()
+		m.Time = &t
+		m.Version = "unknown"
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			m.Version = fmt.Sprintf("%s %s (%s)", bi.Main.Path, bi.Main.Version, bi.GoVersion)
+		}
+	}
+
+	m.ProfileDate = *profileDate
+	m.Inputs = inputNames()
+	if *baseline != "" {
+		m.Inputs = append(m.Inputs, displayPath(*baseline)+" (baseline)")
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		v := f.Value.String()
+		// Flags taking a path name it as such in their usage.
+		switch name, _ := flag.UnquoteUsage(f); name {
+		case "file", "dir", "directory":
+			v = displayPath(v)
+		case "FILE:START-END":
+			// Print the file as positions in the report are.
+			if i := strings.LastIndexByte(v, ':'); i >= 0 {
+				v = displayPos(v[:i]) + v[i:]
+			}
+		}
+		m.Flags = append(m.Flags, fmt.Sprintf("-%s=%s", f.Name, v))
+	})
+	return m
+}
+
+func printHeader(w io.Writer, m *Metadata) {
+	if m.Version != "" {
+		fmt.Fprintf(w, "# Generated by %s\n", m.Version)
+	}
+	if m.Time != nil {
+		fmt.Fprintf(w, "# Time: %s\n", m.Time.Format(time.RFC3339))
+	}
+	if m.ProfileDate != "" {
+		fmt.Fprintf(w, "# Profile date: %s\n", m.ProfileDate)
+	}
+	fmt.Fprintf(w, "# Input: %s\n", strings.Join(m.Inputs, ", "))
+	fmt.Fprintf(w, "# Flags: %s\n", strings.Join(m.Flags, " "))
+	fmt.Fprintln(w)
+}
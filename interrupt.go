@@ -0,0 +1,40 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+)
+
+// interrupted is set when SIGINT arrives while reading input. Reading stops
+// at the next line, and the report covers the input read so far.
+var interrupted atomic.Bool
+
+// stopOnInterrupt arranges for SIGINT to stop reading input rather than kill
+// the process, until the returned func is called.
+func stopOnInterrupt() (restore func()) {
+	interrupted.Store(false)
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		select {
+		case <-c:
+			interrupted.Store(true)
+			// Unblock a read waiting on a pipe. This has no effect on
+			// regular files, which don't block for long.
+			os.Stdin.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+		os.Stdin.SetReadDeadline(time.Time{})
+	}
+}
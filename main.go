@@ -13,21 +13,38 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"text/template"
+	"time"
 )
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s [flags] [file...]:\n\n", os.Args[0])
 		fmt.Fprintf(flag.CommandLine.Output(), `pgo-analysis parses the JSON output of the Go compiler's
 -d=pgodebug=3 flag and summarizes devirtualization of indirect calls.
+Input is read from the named files, which are merged, or from stdin.
+
+Each flag may be given a default in the environment variable named for it
+in upper case with dashes replaced by underscores and prefixed with
+PGO_ANALYSIS_, e.g. PGO_ANALYSIS_PKG for -pkg. Flags given on the command
+line take precedence over the environment.
 
 Example:
 	$ go build -gcflags=all=-d=pgodebug=3 >/tmp/log.txt 2>&1
@@ -47,6 +64,10 @@ type CallStat struct {
 	Caller string
 
 	// Call type. Interface must not be Direct.
+	//
+	// The call type is that of the call as written, before
+	// devirtualization: a devirtualized call is not Direct, but has
+	// Devirtualized set. Direct calls are thus direct in the source.
 	Direct    bool
 	Interface bool
 
@@ -62,6 +83,10 @@ type CallStat struct {
 	// the same line. Hottest doesn't do that.
 	Devirtualized       string
 	DevirtualizedWeight int64
+
+	// Number of distinct callees seen in the profile, if the compiler
+	// reports it. 0 if unknown.
+	NumCallees int64 `json:",omitempty"`
 }
 
 var cwd = func() string {
@@ -81,32 +106,257 @@ func normalizePos(pos string) string {
 	return filepath.Join(cwd, pos)
 }
 
-func readStats() ([]CallStat, map[string][]string, error) {
-	var stats []CallStat
-	inlined := make(map[string][]string) // pos -> []symbol
+var relativePos = flag.Bool("relative-pos", false, "print positions relative to -build-dir, or the current directory, so reports are portable across machines; positions outside it stay absolute")
 
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		line := scanner.Bytes()
+// flagAliases maps shorthand flag names to the flags they set.
+var flagAliases = map[string]string{
+	"relative": "relative-pos",
+}
+
+func init() {
+	flag.BoolVar(relativePos, "relative", false, "shorthand for -relative-pos")
+}
 
-		m := inlinedCallRe.FindStringSubmatch(string(line))
-		if len(m) == 3 {
-			pos := normalizePos(m[1])
-			inlined[pos] = append(inlined[pos], m[2])
+// displayPos returns pos as it should be printed.
+func displayPos(pos string) string {
+	if !*relativePos && !*deterministic {
+		return pos
+	}
+	base := cwd
+	if *buildDir != "" {
+		if abs, err := filepath.Abs(*buildDir); err == nil {
+			base = abs
 		}
+	}
+	abs := normalizePos(pos)
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return rel
+}
 
-		var stat CallStat
-		if err := json.Unmarshal(line, &stat); err != nil {
-			//log.Printf("Failed to unmarshal %q: %v", scanner.Text(), err)
-			continue
+func newResult() *Result {
+	return &Result{
+		Inlined:    make(map[string][]string),
+		NotInlined: make(map[string][]string),
+	}
+}
+
+func readStats(in io.Reader) (*Result, error) {
+	return readStatsIn(in, "")
+}
+
+// readStatsIn is readStats, resolving relative positions against dir rather
+// than the current directory if dir is set.
+func readStatsIn(in io.Reader, dir string) (*Result, error) {
+	if *test2json {
+		in = newTest2JSONReader(in)
+	}
+	if *parallel > 1 {
+		return readStatsParallel(in, *parallel, dir)
+	}
+
+	r := newResult()
+	r.dir = dir
+	if err := forEachLine(in, r.parseLine); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+var maxLines = flag.Int64("max-lines", 0, "stop reading input after `N` lines and report on those, warning that the report is truncated; 0 means no limit")
+
+// linesRead counts the lines read for -max-lines. truncated is set once
+// reading stops because of it. bytesRead counts the bytes read, for
+// -timing.
+var (
+	linesRead atomic.Int64
+	truncated atomic.Bool
+	bytesRead atomic.Int64
+)
+
+// resetMaxLines restarts the -max-lines and -timing counts for a new input.
+func resetMaxLines() {
+	linesRead.Store(0)
+	truncated.Store(false)
+	bytesRead.Store(0)
+}
+
+// forEachLine calls fn with each line of in, without the line terminator,
+// stopping early without error if interrupted or past -max-lines.
+func forEachLine(in io.Reader, fn func(line []byte)) error {
+	// Unlike bufio.Scanner, ReadBytes has no maximum line length. pgodebug
+	// lines with long generic type names can exceed the Scanner's 64KB
+	// default.
+	//
+	// Reads from a pipe or FIFO block until data arrives, so input ends
+	// only at EOF, once every writer has closed it.
+	br := bufio.NewReader(in)
+	for {
+		line, err := br.ReadBytes('\n')
+		if interrupted.Load() {
+			return nil
+		}
+		if len(line) > 0 {
+			if *maxLines > 0 && linesRead.Add(1) > *maxLines {
+				truncated.Store(true)
+				return nil
+			}
+			bytesRead.Add(int64(len(line)))
+			fn(bytes.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseLine records a single line of compiler output in r.
+func (r *Result) parseLine(line []byte) {
+	r.Parse.Lines++
+
+	if *mFlag && parseInlineDiag(r, string(line)) {
+		r.Parse.InlineLines++
+		return
+	}
+
+	m := inlinedCallRe.FindStringSubmatch(string(line))
+	if len(m) == 3 {
+		pos := r.resolvePos(m[1])
+		r.Inlined[pos] = append(r.Inlined[pos], m[2])
+		r.Parse.InlineLines++
+		return
+	}
+
+	var stat CallStat
+	if err := json.Unmarshal(line, &stat); err != nil {
+		//log.Printf("Failed to unmarshal %q: %v", line, err)
+		r.Parse.Skipped++
+		if len(bytes.TrimSpace(line)) == 0 {
+			r.Parse.Blank++
+		}
+		if *logSkipped != "" {
+			r.skipped = append(r.skipped, skippedLine{line: r.Parse.Lines, text: string(line)})
 		}
-		stats = append(stats, stat)
+		return
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, nil, err
+	if r.dir != "" {
+		stat.Pos = r.resolvePos(stat.Pos)
 	}
+	r.Stats = append(r.Stats, stat)
+	r.Parse.StatLines++
+	if !bytes.Contains(line, []byte(`"Devirtualized"`)) {
+		r.Parse.Undetailed++
+	}
+}
+
+// resolvePos is normalizePos, but resolves relative positions against r.dir
+// if set.
+func (r *Result) resolvePos(pos string) string {
+	if r.dir == "" || filepath.IsAbs(pos) {
+		return normalizePos(pos)
+	}
+	return filepath.Join(r.dir, pos)
+}
 
-	return stats, inlined, nil
+// ParseStats counts how the lines of the input were interpreted.
+type ParseStats struct {
+	Lines       int64 // total lines read
+	StatLines   int64 // lines parsed as a CallStat
+	InlineLines int64 // lines parsed as an inlining diagnostic
+	Skipped     int64 // lines that were neither
+	Blank       int64 // skipped lines that were blank
+	Undetailed  int64 // call stats without devirtualization detail
+}
+
+func (p *ParseStats) add(q *ParseStats) {
+	p.Lines += q.Lines
+	p.StatLines += q.StatLines
+	p.InlineLines += q.InlineLines
+	p.Skipped += q.Skipped
+	p.Blank += q.Blank
+	p.Undetailed += q.Undetailed
+}
+
+var debugLevel = flag.Int("debug-level", 0, "the -d=pgodebug `level` the input was produced with; levels below 3 lack devirtualization detail, so those sections are omitted (default detect from the input)")
+
+// devirtSections are the sections that are meaningless without
+// devirtualization detail.
+var devirtSections = map[string]bool{
+	"devirtualized":            true,
+	"inlined":                  true,
+	"inline-matrix":            true,
+	"inlined-missed":           true,
+	"missed":                   true,
+	"near-miss":                true,
+	"monomorphic":              true,
+	"partition":                true,
+	"diff":                     true,
+	"diff-patch":               true,
+	"undevirtualized-packages": true,
+	"completeness":             true,
+	"cross-package":            true,
+	"by-interface":             true,
+	"top-per-interface":        true,
+	"classes":                  true,
+	"tags":                     true,
+}
+
+// devirtDetail reports whether the input records devirtualization
+// decisions. Logs from -d=pgodebug=2 omit the Devirtualized fields, which
+// would otherwise read as nothing having been devirtualized.
+func (r *Result) devirtDetail() bool {
+	if *debugLevel != 0 {
+		return *debugLevel >= 3
+	}
+	return r.Parse.StatLines == 0 || r.Parse.Undetailed < r.Parse.StatLines
+}
+
+var (
+	parseStatsFlag   = flag.Bool("parse-stats", false, "print counts of input lines read, parsed, and skipped to stderr")
+	requireJSONRatio = flag.Float64("require-json-ratio", 0, "fail if fewer than this `percent` of non-blank input lines are pgodebug call stats")
+	validate         = flag.Bool("validate", false, "only parse the input and print counts of input lines read, parsed, and skipped, failing if no call stats were found")
+)
+
+var timing = flag.Bool("timing", false, "print the time taken to read and parse the input, and its throughput, to stderr")
+
+func printTiming(w io.Writer, p *ParseStats, d time.Duration) {
+	mb := float64(bytesRead.Load()) / 1e6
+	secs := d.Seconds()
+	fmt.Fprintf(w, "Read %d lines (%.2f MB) in %v: %.0f lines/s, %.2f MB/s\n", p.Lines, mb, d.Round(time.Millisecond), float64(p.Lines)/secs, mb/secs)
+}
+
+func printParseStats(w io.Writer, p *ParseStats) {
+	fmt.Fprintf(w, "Parsed %d lines: %d call stats, %d inlining lines, %d skipped (%.2f%%)\n", p.Lines, p.StatLines, p.InlineLines, p.Skipped, pct(p.Skipped, p.Lines))
+}
+
+var mFlag = flag.Bool("m", false, "also parse inlining diagnostics from the compiler's -m flag")
+
+// -m=2 follows the inlined symbol with its signature and body, so only take
+// the first field as the symbol.
+var (
+	mInlinedCallRe  = regexp.MustCompile(`^(\S+): inlining call to (\S+)`)
+	mCannotInlineRe = regexp.MustCompile(`^(\S+): cannot inline (?:call to )?(\S+): (.*)$`)
+)
+
+// parseInlineDiag records an -m inlining diagnostic in r, returning false if
+// line is not one.
+func parseInlineDiag(r *Result, line string) bool {
+	if m := mInlinedCallRe.FindStringSubmatch(line); len(m) == 3 {
+		pos := r.resolvePos(m[1])
+		r.Inlined[pos] = append(r.Inlined[pos], m[2])
+		return true
+	}
+	if m := mCannotInlineRe.FindStringSubmatch(line); len(m) == 4 {
+		pos := r.resolvePos(m[1])
+		r.NotInlined[pos] = append(r.NotInlined[pos], fmt.Sprintf("%s: %s", m[2], m[3]))
+		return true
+	}
+	return false
 }
 
 type sum struct {
@@ -116,123 +366,1292 @@ type sum struct {
 }
 
 func (s *sum) total() int64 {
-	return s.direct + s.indirectFunc + s.indirectMethod
+	t, _ := satAdd(s.direct, s.indirectFunc)
+	t, _ = satAdd(t, s.indirectMethod)
+	return t
 }
 
 func pct(n, d int64) float64 {
 	return 100 * float64(n) / float64(d)
 }
 
-func run() error {
-	stats, inlined, err := readStats()
-	if err != nil {
-		return err
-	}
+// Result holds the parsed input along with the aggregate totals shared by
+// the report sections.
+type Result struct {
+	Stats   []CallStat
+	Inlined map[string][]string // pos -> []symbol
 
-	var (
-		count               sum
-		weight              sum
-		hottestWeight       sum
-		devirtualizedCount  sum
-		devirtualizedWeight sum
-	)
+	// NotInlined is only populated with -m.
+	NotInlined map[string][]string // pos -> []"symbol: reason"
 
-	for _, s := range stats {
+	Parse ParseStats
+
+	// dir, if set, is the directory that relative positions are resolved
+	// against while parsing, rather than the current directory.
+	dir string
+
+	// skipped are the unrecognized input lines, with -log-skipped.
+	skipped []skippedLine
+
+	// Partial is set if reading the input was interrupted or stopped at
+	// -max-lines.
+	Partial bool
+
+	// If non-nil, Classifier labels callsites with a custom class, and
+	// summarize additionally totals the callsites of each class.
+	Classifier func(CallStat) string
+	classes    map[string]*Result
+
+	// Baseline is the result for -baseline, if any.
+	Baseline *Result
+
+	// With -by-tag, Tagged holds the result for each input, named by Tag.
+	Tagged []*Result
+	Tag    string
+
+	count               sum
+	weight              sum
+	hottestWeight       sum
+	devirtualizedCount  sum
+	devirtualizedWeight sum
+
+	// Devirtualized calls with inlined calls at the same position: the
+	// devirtualizations that paid off with inlining.
+	devirtualizedInlinedWeight sum
+
+	// Indirect calls that were not devirtualized, yet have inlined calls
+	// at the same position.
+	inlinedCount  sum
+	inlinedWeight sum
+
+	// overflow is set if a weight sum overflowed or went negative.
+	overflow bool
+}
+
+// summarize computes the aggregate totals over r.Stats.
+func (r *Result) summarize() {
+	for _, s := range r.Stats {
 		if s.Direct {
-			count.direct++
-			weight.direct += s.Weight
-			hottestWeight.direct += s.Weight
+			r.count.direct++
+			r.add(&r.weight.direct, s.Weight)
+			r.add(&r.hottestWeight.direct, s.Weight)
 		} else if s.Interface {
-			count.indirectMethod++
-			weight.indirectMethod += s.Weight
-			hottestWeight.indirectMethod += s.HottestWeight
+			r.count.indirectMethod++
+			r.add(&r.weight.indirectMethod, s.Weight)
+			r.add(&r.hottestWeight.indirectMethod, s.HottestWeight)
 			if s.Devirtualized != "" {
-				devirtualizedCount.indirectMethod++
-				devirtualizedWeight.indirectMethod += s.DevirtualizedWeight
+				r.devirtualizedCount.indirectMethod++
+				r.add(&r.devirtualizedWeight.indirectMethod, s.DevirtualizedWeight)
+				if len(r.Inlined[s.Pos]) > 0 {
+					r.add(&r.devirtualizedInlinedWeight.indirectMethod, s.DevirtualizedWeight)
+				}
+			} else if len(r.Inlined[s.Pos]) > 0 {
+				r.inlinedCount.indirectMethod++
+				r.add(&r.inlinedWeight.indirectMethod, s.Weight)
 			}
 		} else {
-			count.indirectFunc++
-			weight.indirectFunc += s.Weight
-			hottestWeight.indirectFunc += s.HottestWeight
+			r.count.indirectFunc++
+			r.add(&r.weight.indirectFunc, s.Weight)
+			r.add(&r.hottestWeight.indirectFunc, s.HottestWeight)
 			if s.Devirtualized != "" {
-				devirtualizedCount.indirectFunc++
-				devirtualizedWeight.indirectFunc += s.DevirtualizedWeight
+				r.devirtualizedCount.indirectFunc++
+				r.add(&r.devirtualizedWeight.indirectFunc, s.DevirtualizedWeight)
+				if len(r.Inlined[s.Pos]) > 0 {
+					r.add(&r.devirtualizedInlinedWeight.indirectFunc, s.DevirtualizedWeight)
+				}
+			} else if len(r.Inlined[s.Pos]) > 0 {
+				r.inlinedCount.indirectFunc++
+				r.add(&r.inlinedWeight.indirectFunc, s.Weight)
 			}
 		}
 	}
+	if r.overflow {
+		log.Printf("Warning: weight sums overflowed or went negative; totals and percentages are unreliable")
+	}
 
-	fmt.Printf("Call count breakdown:\n")
-	fmt.Printf("\tTotal: %d\n", count.total())
-	fmt.Printf("\tDirect: %d (%.2f%% of total)\n", count.direct, pct(count.direct, count.total()))
-	fmt.Printf("\tIndirect func: %d (%.2f%% of total)\n", count.indirectFunc, pct(count.indirectFunc, count.total()))
-	fmt.Printf("\tInterface method: %d (%.2f%% of total)\n", count.indirectMethod, pct(count.indirectMethod, count.total()))
+	if r.Classifier != nil {
+		r.classes = make(map[string]*Result)
+		for _, s := range r.Stats {
+			label := r.Classifier(s)
+			c, ok := r.classes[label]
+			if !ok {
+				c = &Result{Inlined: r.Inlined, NotInlined: r.NotInlined}
+				r.classes[label] = c
+			}
+			c.Stats = append(c.Stats, s)
+		}
+		for _, c := range r.classes {
+			c.summarize()
+		}
+	}
+}
 
-	fmt.Printf("Call weight breakdown:\n")
-	fmt.Printf("\tTotal: %d\n", weight.total())
-	fmt.Printf("\tDirect: %d (%.2f%% of total)\n", weight.direct, pct(weight.direct, weight.total()))
-	fmt.Printf("\tIndirect func: %d (%.2f%% of total)\n", weight.indirectFunc, pct(weight.indirectFunc, weight.total()))
-	fmt.Printf("\tInterface method: %d (%.2f%% of total)\n", weight.indirectMethod, pct(weight.indirectMethod, weight.total()))
+// satAdd returns a+b, saturating at the int64 limits rather than wrapping.
+// ok is false if the sum saturated.
+func satAdd(a, b int64) (sum int64, ok bool) {
+	s := a + b
+	switch {
+	case b > 0 && s < a:
+		return math.MaxInt64, false
+	case b < 0 && s > a:
+		return math.MinInt64, false
+	}
+	return s, true
+}
 
-	fmt.Printf("Call hottest weight breakdown:\n")
-	fmt.Printf("\tTotal: %d (%.2f%% of total)\n", hottestWeight.total(), pct(hottestWeight.total(), weight.total()))
-	fmt.Printf("\tDirect: %d (%.2f%% of direct)\n", hottestWeight.direct, pct(hottestWeight.direct, weight.direct))
-	fmt.Printf("\tIndirect func: %d (%.2f%% of indirect func)\n", hottestWeight.indirectFunc, pct(hottestWeight.indirectFunc, weight.indirectFunc))
-	fmt.Printf("\tInterface method: %d (%.2f%% of interface method)\n", hottestWeight.indirectMethod, pct(hottestWeight.indirectMethod, weight.indirectMethod))
+// add adds weight n to the running sum *dst, recording in r.overflow if the
+// sum overflows or goes negative.
+func (r *Result) add(dst *int64, n int64) {
+	s, ok := satAdd(*dst, n)
+	if !ok || s < 0 {
+		r.overflow = true
+	}
+	*dst = s
+}
 
-	fmt.Printf("Devirtualized interface call count: %d (%.2f%% of total, %.2f%% of interface method)\n", devirtualizedCount.indirectMethod, pct(devirtualizedCount.indirectMethod, count.total()), pct(devirtualizedCount.indirectMethod, count.indirectMethod))
-	fmt.Printf("Devirtualized interface call weight: %d (%.2f%% of total, %.2f%% of interface method)\n", devirtualizedWeight.indirectMethod, pct(devirtualizedWeight.indirectMethod, weight.total()), pct(devirtualizedWeight.indirectMethod, weight.indirectMethod))
-	fmt.Printf("Devirtualized function call count: %d (%.2f%% of total, %.2f%% of indirect func)\n", devirtualizedCount.indirectFunc, pct(devirtualizedCount.indirectFunc, count.total()), pct(devirtualizedCount.indirectFunc, count.indirectFunc))
-	fmt.Printf("Devirtualized function call weight: %d (%.2f%% of total, %.2f%% of indirect func)\n", devirtualizedWeight.indirectFunc, pct(devirtualizedWeight.indirectFunc, weight.total()), pct(devirtualizedWeight.indirectFunc, weight.indirectFunc))
+var totalWeight = flag.Int64("total-weight", 0, "if non-zero, compute weight percentages relative to this total profile weight rather than the total weight of the input")
 
-	const topCount = 100
-	fmt.Printf("\nTop %d hottest indirect calls:\n", topCount)
-	sort.Slice(stats, func(i, j int) bool {
-		if stats[i].HottestWeight != stats[j].HottestWeight {
-			return stats[i].HottestWeight < stats[j].HottestWeight
+// totalWeight returns the denominator for percentages of total weight.
+func (r *Result) totalWeight() int64 {
+	if *totalWeight > 0 {
+		return *totalWeight
+	}
+	return r.weight.total()
+}
+
+// category is one of the call types in the breakdowns.
+type category struct {
+	label string // row label
+	of    string // name when used as a denominator
+	get   func(s *sum) int64
+}
+
+var categories = []category{
+	{"Direct", "direct", func(s *sum) int64 { return s.direct }},
+	{"Indirect func", "indirect func", func(s *sum) int64 { return s.indirectFunc }},
+	{"Interface method", "interface method", func(s *sum) int64 { return s.indirectMethod }},
+}
+
+var sortBreakdown = flag.Bool("sort-breakdown", false, "order breakdown rows by descending weight rather than by call type")
+
+// breakdownCategories returns the categories in breakdown row order.
+func (r *Result) breakdownCategories() []category {
+	if !*sortBreakdown {
+		return categories
+	}
+	sorted := append([]category(nil), categories...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].get(&r.weight) > sorted[j].get(&r.weight)
+	})
+	return sorted
+}
+
+func printCountBreakdown(w io.Writer, r *Result) {
+	count := &r.count
+	fmt.Fprintf(w, "Call count breakdown:\n")
+	fmt.Fprintf(w, "\tTotal: %d\n", count.total())
+	for _, c := range r.breakdownCategories() {
+		fmt.Fprintf(w, "\t%s: %d (%.2f%% of total)\n", c.label, c.get(count), pct(c.get(count), count.total()))
+	}
+	printCallees(w, r)
+	// Direct counts calls direct in the source; devirtualized calls are
+	// counted as indirect.
+	if !r.devirtDetail() {
+		return
+	}
+	devirtualized := r.devirtualizedCount.indirectFunc + r.devirtualizedCount.indirectMethod
+	fmt.Fprintf(w, "\tDirect after devirtualization: %d (%d direct in source + %d devirtualized)\n", count.direct+devirtualized, count.direct, devirtualized)
+}
+
+var unit = flag.String("unit", "", "label weights in the report with this `unit`, such as samples or cpu-ns")
+
+// units formats weight n, labeled with the -unit if any.
+func units(n int64) string {
+	if *unit == "" {
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprintf("%d %s", n, *unit)
+}
+
+var relativeWeights = flag.Bool("relative-weights", false, "print breakdown weights only as percentages, omitting absolute values")
+
+// fmtWeight formats weight n as a percentage of d, labeled as being "of" the
+// given category. The absolute weight is included unless -relative-weights
+// is set.
+func fmtWeight(n, d int64, of string) string {
+	if *relativeWeights {
+		return fmt.Sprintf("%.2f%% of %s", pct(n, d), of)
+	}
+	return fmt.Sprintf("%s (%.2f%% of %s)", units(n), pct(n, d), of)
+}
+
+func printWeightBreakdown(w io.Writer, r *Result) {
+	weight := &r.weight
+	fmt.Fprintf(w, "Call weight breakdown:\n")
+	switch {
+	case *totalWeight > 0:
+		fmt.Fprintf(w, "\tTotal: %s\n", fmtWeight(weight.total(), *totalWeight, "total"))
+	case *relativeWeights:
+		fmt.Fprintf(w, "\tTotal: 100.00%%\n")
+	default:
+		fmt.Fprintf(w, "\tTotal: %s\n", units(weight.total()))
+	}
+	for _, c := range r.breakdownCategories() {
+		fmt.Fprintf(w, "\t%s: %s\n", c.label, fmtWeight(c.get(weight), r.totalWeight(), "total"))
+	}
+}
+
+func printHottestWeightBreakdown(w io.Writer, r *Result) {
+	weight, hottestWeight := &r.weight, &r.hottestWeight
+	fmt.Fprintf(w, "Call hottest weight breakdown:\n")
+	fmt.Fprintf(w, "\tTotal: %s\n", fmtWeight(hottestWeight.total(), r.totalWeight(), "total"))
+	for _, c := range r.breakdownCategories() {
+		fmt.Fprintf(w, "\t%s: %s\n", c.label, fmtWeight(c.get(hottestWeight), c.get(weight), c.of))
+	}
+}
+
+func printDevirtualized(w io.Writer, r *Result) {
+	count, weight := &r.count, &r.weight
+	devirtualizedCount, devirtualizedWeight := &r.devirtualizedCount, &r.devirtualizedWeight
+	fmt.Fprintf(w, "Devirtualized interface call count: %d (%.2f%% of total, %.2f%% of interface method)\n", devirtualizedCount.indirectMethod, pct(devirtualizedCount.indirectMethod, count.total()), pct(devirtualizedCount.indirectMethod, count.indirectMethod))
+	if *relativeWeights {
+		fmt.Fprintf(w, "Devirtualized interface call weight: %.2f%% of total, %.2f%% of interface method\n", pct(devirtualizedWeight.indirectMethod, r.totalWeight()), pct(devirtualizedWeight.indirectMethod, weight.indirectMethod))
+	} else {
+		fmt.Fprintf(w, "Devirtualized interface call weight: %s (%.2f%% of total, %.2f%% of interface method)\n", units(devirtualizedWeight.indirectMethod), pct(devirtualizedWeight.indirectMethod, r.totalWeight()), pct(devirtualizedWeight.indirectMethod, weight.indirectMethod))
+	}
+	fmt.Fprintf(w, "Devirtualized function call count: %d (%.2f%% of total, %.2f%% of indirect func)\n", devirtualizedCount.indirectFunc, pct(devirtualizedCount.indirectFunc, count.total()), pct(devirtualizedCount.indirectFunc, count.indirectFunc))
+	if *relativeWeights {
+		fmt.Fprintf(w, "Devirtualized function call weight: %.2f%% of total, %.2f%% of indirect func\n", pct(devirtualizedWeight.indirectFunc, r.totalWeight()), pct(devirtualizedWeight.indirectFunc, weight.indirectFunc))
+	} else {
+		fmt.Fprintf(w, "Devirtualized function call weight: %s (%.2f%% of total, %.2f%% of indirect func)\n", units(devirtualizedWeight.indirectFunc), pct(devirtualizedWeight.indirectFunc, r.totalWeight()), pct(devirtualizedWeight.indirectFunc, weight.indirectFunc))
+	}
+	inlined, devirtualized := r.devirtualizedInlinedWeight.indirectFunc+r.devirtualizedInlinedWeight.indirectMethod, devirtualizedWeight.indirectFunc+devirtualizedWeight.indirectMethod
+	if *relativeWeights {
+		fmt.Fprintf(w, "Devirtualized and inlined weight: %.2f%% of devirtualized weight\n", pct(inlined, devirtualized))
+	} else {
+		fmt.Fprintf(w, "Devirtualized and inlined weight: %s (%.2f%% of devirtualized weight)\n", units(inlined), pct(inlined, devirtualized))
+	}
+}
+
+var partition = flag.Bool("partition", false, "split total call weight three ways: direct calls, indirect call weight devirtualized, and indirect call weight remaining indirect")
+
+// printPartition prints how much of the program's call weight is static in
+// the source, made static by PGO devirtualization, and still dynamic.
+func printPartition(w io.Writer, r *Result) {
+	weight := &r.weight
+	devirtualized := r.devirtualizedWeight.indirectFunc + r.devirtualizedWeight.indirectMethod
+	remaining := weight.indirectFunc + weight.indirectMethod - devirtualized
+	fmt.Fprintf(w, "\nCall weight by how it is called:\n")
+	fmt.Fprintf(w, "\tDirect: %s\n", fmtWeight(weight.direct, r.totalWeight(), "total"))
+	fmt.Fprintf(w, "\tDevirtualized: %s\n", fmtWeight(devirtualized, r.totalWeight(), "total"))
+	fmt.Fprintf(w, "\tRemaining indirect: %s\n", fmtWeight(remaining, r.totalWeight(), "total"))
+}
+
+var noSparkline = flag.Bool("no-sparkline", false, "omit the sparkline of hottest callee shares, e.g. for terminals without Unicode")
+
+// sparkBlocks are the bars of a sparkline, lowest to highest.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// printSparkline prints a histogram of the hottest callee share of indirect
+// callsites as a one-line sparkline, in 10% buckets. Mass on the left means
+// polymorphic callsites; on the right, callsites dominated by one callee.
+func printSparkline(w io.Writer, r *Result) {
+	if *noSparkline {
+		return
+	}
+	var buckets [10]int
+	var peak int
+	for _, s := range r.Stats {
+		if s.Direct {
+			continue
 		}
-		if stats[i].Pkg != stats[j].Pkg {
-			return stats[i].Pkg < stats[j].Pkg
+		i := min(int(hottestShare(s)/10), len(buckets)-1)
+		buckets[i]++
+		peak = max(peak, buckets[i])
+	}
+	var b strings.Builder
+	for _, n := range buckets {
+		if n == 0 {
+			b.WriteRune(' ')
+		} else {
+			b.WriteRune(sparkBlocks[(n*len(sparkBlocks)-1)/peak])
 		}
-		return stats[i].Pos < stats[j].Pos
+	}
+	fmt.Fprintf(w, "Hottest callee share of indirect callsites: 0%% |%s| 100%%\n", b.String())
+}
+
+var inlinedCategory = flag.Bool("inlined-category", false, "print indirect calls that were not devirtualized but have inlined calls at the same position")
+
+func printInlinedNotDevirtualized(w io.Writer, r *Result) {
+	count, weight := &r.count, &r.weight
+	inlinedCount, inlinedWeight := &r.inlinedCount, &r.inlinedWeight
+	fmt.Fprintf(w, "Not devirtualized but inlined at position:\n")
+	fmt.Fprintf(w, "\tInterface method count: %d (%.2f%% of interface method)\n", inlinedCount.indirectMethod, pct(inlinedCount.indirectMethod, count.indirectMethod))
+	fmt.Fprintf(w, "\tInterface method weight: %s (%.2f%% of interface method)\n", units(inlinedWeight.indirectMethod), pct(inlinedWeight.indirectMethod, weight.indirectMethod))
+	fmt.Fprintf(w, "\tIndirect func count: %d (%.2f%% of indirect func)\n", inlinedCount.indirectFunc, pct(inlinedCount.indirectFunc, count.indirectFunc))
+	fmt.Fprintf(w, "\tIndirect func weight: %s (%.2f%% of indirect func)\n", units(inlinedWeight.indirectFunc), pct(inlinedWeight.indirectFunc, weight.indirectFunc))
+}
+
+var inlinedMissed = flag.Int("inlined-missed", 0, "print the `N` heaviest positions with inlined calls yet a non-devirtualized indirect call")
+
+// printInlinedMissed lists the positions where inlining exposed an indirect
+// call that devirtualization then missed, a known high-value pattern.
+func printInlinedMissed(w io.Writer, r *Result) {
+	type position struct {
+		pos    string
+		weight int64
+		calls  int
+	}
+	m := make(map[string]*position)
+	var total int64
+	for _, s := range r.Stats {
+		if s.Direct || s.Devirtualized != "" || len(r.Inlined[s.Pos]) == 0 {
+			continue
+		}
+		p, ok := m[s.Pos]
+		if !ok {
+			p = &position{pos: s.Pos}
+			m[s.Pos] = p
+		}
+		p.weight += s.Weight
+		p.calls++
+		total += s.Weight
+	}
+	positions := make([]*position, 0, len(m))
+	for _, p := range m {
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].weight != positions[j].weight {
+			return positions[i].weight > positions[j].weight
+		}
+		return positions[i].pos < positions[j].pos
 	})
-	printed := 0
-	var topWeight, topHottestWeight int64
-	for i := len(stats) - 1; i >= 0 && printed < topCount; i-- {
-		s := stats[i]
+	n := *inlinedMissed
+	if n <= 0 {
+		n = defaultTopCount
+	}
+	if len(positions) > n {
+		positions = positions[:n]
+	}
+
+	fmt.Fprintf(w, "\nInlined positions with non-devirtualized indirect calls: %s weight (%.2f%% of indirect weight) at %d positions\n", units(total), pct(total, r.weight.indirectFunc+r.weight.indirectMethod), len(m))
+	for _, p := range positions {
+		fmt.Fprintf(w, "\t%s weight %s (%d indirect calls)\n", displayPos(p.pos), units(p.weight), p.calls)
+		for _, s := range r.Inlined[p.pos] {
+			fmt.Fprintf(w, "\t\tinlined %s\n", s)
+		}
+	}
+}
+
+var inlineMatrix = flag.Bool("inline-matrix", false, "print a table of indirect calls by whether they were devirtualized and whether there are inlined calls at their position")
+
+// printInlineMatrix cross-tabulates devirtualization of indirect calls with
+// inlining at the same position, to show how the two optimizations
+// interact.
+func printInlineMatrix(w io.Writer, r *Result) {
+	var count, weight [2][2]int64 // [inlined][devirtualized]
+	b2i := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	for _, s := range r.Stats {
 		if s.Direct {
 			continue
 		}
-		spec := "NOT Devirtualized"
-		specExtra := ""
-		if s.Devirtualized != "" {
-			spec = "    Devirtualized"
-			if s.Devirtualized != s.Hottest {
-				specExtra = fmt.Sprintf("\t(devirtualized to %s weight %d)", s.Devirtualized, s.DevirtualizedWeight)
-			}
+		i, d := b2i(len(r.Inlined[s.Pos]) > 0), b2i(s.Devirtualized != "")
+		count[i][d]++
+		weight[i][d] += s.Weight
+	}
+	indirectWeight := r.weight.indirectFunc + r.weight.indirectMethod
+
+	fmt.Fprintf(w, "\nIndirect calls by inlining and devirtualization (count, weight):\n")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "\t\tDevirtualized\tNot devirtualized\n")
+	for _, i := range []int{1, 0} {
+		label := "Inlined at position"
+		if i == 0 {
+			label = "Not inlined"
+		}
+		fmt.Fprintf(tw, "\t%s", label)
+		for _, d := range []int{1, 0} {
+			fmt.Fprintf(tw, "\t%d, %s (%.2f%%)", count[i][d], units(weight[i][d]), pct(weight[i][d], indirectWeight))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+var (
+	topMissedWeight = flag.Bool("top-missed-weight", false, "print the hottest weight of concentrated indirect calls that were not devirtualized")
+	missedThreshold = flag.Float64("missed-threshold", 90, "minimum hottest callee `percent`age of callsite weight for -top-missed-weight and -format=opportunities")
+)
+
+// printMissedWeight prints the weight that the devirtualizer could
+// plausibly have realized: indirect calls that were not devirtualized even
+// though a single callee dominates the callsite.
+func printMissedWeight(w io.Writer, r *Result) {
+	var count, missed int64
+	for _, s := range r.Stats {
+		if s.Direct || s.Devirtualized != "" {
+			continue
+		}
+		if hottestShare(s) < *missedThreshold {
+			continue
+		}
+		count++
+		missed += s.HottestWeight
+	}
+	hottestWeight := &r.hottestWeight
+	fmt.Fprintf(w, "Missed devirtualization weight (hottest >= %.2f%% of callsite weight): %s (%d calls, %.2f%% of indirect hottest weight)\n", *missedThreshold, units(missed), count, pct(missed, hottestWeight.indirectFunc+hottestWeight.indirectMethod))
+}
+
+var nearMiss = flag.Float64("near-miss", 0, "list non-devirtualized indirect calls whose hottest callee share of callsite weight is within this many `percent`age points below -missed-threshold (10 if the section is selected by -sections)")
+
+// defaultNearMiss is the -near-miss margin of the near-miss section when it
+// is selected by -sections rather than -near-miss.
+const defaultNearMiss = 10
+
+// printNearMisses prints the non-devirtualized indirect calls that fall just
+// short of -missed-threshold, where a better profile or a relaxed heuristic
+// might tip them over into devirtualization.
+func printNearMisses(w io.Writer, r *Result) {
+	margin := *nearMiss
+	if margin <= 0 {
+		margin = defaultNearMiss
+	}
+	lo := *missedThreshold - margin
+	fmt.Fprintf(w, "\nNear misses (hottest %.2f%%-%.2f%% of callsite weight):\n", lo, *missedThreshold)
+	stats := sortedByHottest(r.Stats)
+	var count, weight int64
+	for i := len(stats) - 1; i >= 0; i-- {
+		s := stats[i]
+		if s.Direct || s.Devirtualized != "" {
+			continue
+		}
+		share := hottestShare(s)
+		if share < lo || share >= *missedThreshold {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s -> %s (weight %s, %.2f%% of callsite weight)\t%s\n", s.Caller, s.Hottest, units(s.HottestWeight), share, displayPos(s.Pos))
+		count++
+		weight += s.HottestWeight
+	}
+	hottestWeight := &r.hottestWeight
+	fmt.Fprintf(w, "Near miss weight: %s (%d calls, %.2f%% of indirect hottest weight)\n", units(weight), count, pct(weight, hottestWeight.indirectFunc+hottestWeight.indirectMethod))
+}
+
+var monomorphicMisses = flag.Bool("monomorphic-misses", false, "list indirect calls with a single observed callee that were nonetheless not devirtualized")
+
+// printMonomorphicMisses prints the non-devirtualized indirect calls whose
+// hottest callee receives all of the callsite weight. Nothing in the profile
+// argues against devirtualizing these, so each points at a restriction or
+// bug in the compiler.
+func printMonomorphicMisses(w io.Writer, r *Result) {
+	fmt.Fprintf(w, "\nNon-devirtualized indirect calls with a single callee:\n")
+	stats := sortedBy(r.Stats, func(s CallStat) int64 { return s.Weight })
+	var count, weight int64
+	for i := len(stats) - 1; i >= 0; i-- {
+		s := stats[i]
+		if s.Direct || s.Devirtualized != "" || s.Weight == 0 || s.HottestWeight != s.Weight {
+			continue
 		}
 		typ := "interface"
 		if !s.Interface {
-			typ = " function"
+			typ = "function"
+		}
+		fmt.Fprintf(w, "\t(%s) %s -> %s (weight %s)\t%s%s\n", typ, s.Caller, s.Hottest, units(s.Weight), displayPos(s.Pos), moduleTag(s.Pkg))
+		count++
+		weight += s.Weight
+	}
+	fmt.Fprintf(w, "Single-callee miss weight: %s (%d calls, %.2f%% of indirect weight)\n", units(weight), count, pct(weight, r.weight.indirectFunc+r.weight.indirectMethod))
+}
+
+var (
+	failUnder = flag.Float64("fail-under", 0, "exit with a failure status if less than this `percent` of indirect call weight was devirtualized")
+	quiet     = flag.Bool("quiet", false, "with -fail-under, print only the pass/fail verdict")
+)
+
+var errGateFailed = errors.New("devirtualization below -fail-under")
+
+// gate prints whether the devirtualized share of indirect call weight meets
+// -fail-under, returning errGateFailed if not.
+func gate(w io.Writer, r *Result) error {
+	indirectWeight := r.weight.indirectFunc + r.weight.indirectMethod
+	devirtWeight := r.devirtualizedWeight.indirectFunc + r.devirtualizedWeight.indirectMethod
+	rate := pct(devirtWeight, indirectWeight)
+	if rate >= *failUnder {
+		fmt.Fprintf(w, "PASS: %.1f%% >= %g%%\n", rate, *failUnder)
+		return nil
+	}
+	fmt.Fprintf(w, "FAIL: %.1f%% < %g%%\n", rate, *failUnder)
+	return errGateFailed
+}
+
+var oneline = flag.Bool("oneline", false, "print only a single tab-separated summary line: indirect count, indirect weight, devirtualized count, devirtualized weight, and devirtualized percentage of indirect weight")
+
+func printOneline(w io.Writer, r *Result) {
+	indirectCount := r.count.indirectFunc + r.count.indirectMethod
+	indirectWeight := r.weight.indirectFunc + r.weight.indirectMethod
+	devirtCount := r.devirtualizedCount.indirectFunc + r.devirtualizedCount.indirectMethod
+	devirtWeight := r.devirtualizedWeight.indirectFunc + r.devirtualizedWeight.indirectMethod
+	fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%.2f\n", indirectCount, indirectWeight, devirtCount, devirtWeight, pct(devirtWeight, indirectWeight))
+}
+
+var (
+	percentiles          = flag.Bool("percentiles", false, "print percentiles of indirect callsite weight")
+	exactPercentileLimit = flag.Int("exact-percentile-limit", 1_000_000, "maximum number of indirect callsites for which -percentiles are computed exactly; larger inputs are estimated in constant space")
+)
+
+var percentileRanks = []float64{0.50, 0.90, 0.99}
+
+func printPercentiles(w io.Writer, r *Result) {
+	n := int(r.count.indirectFunc + r.count.indirectMethod)
+	if n == 0 {
+		fmt.Fprintf(w, "Indirect call weight percentiles: no indirect callsites\n")
+		return
+	}
+	values := make([]float64, len(percentileRanks))
+	kind := "exact"
+	if n <= *exactPercentileLimit {
+		weights := make([]float64, 0, n)
+		for _, s := range r.Stats {
+			if !s.Direct {
+				weights = append(weights, float64(s.Weight))
+			}
+		}
+		sort.Float64s(weights)
+		for i, p := range percentileRanks {
+			values[i] = exactQuantile(weights, p)
+		}
+	} else {
+		kind = "estimated"
+		estimators := make([]*p2Quantile, len(percentileRanks))
+		for i, p := range percentileRanks {
+			estimators[i] = newP2Quantile(p)
+		}
+		for _, s := range r.Stats {
+			if s.Direct {
+				continue
+			}
+			for _, e := range estimators {
+				e.add(float64(s.Weight))
+			}
+		}
+		for i, e := range estimators {
+			values[i] = e.value()
+		}
+	}
+
+	fmt.Fprintf(w, "Indirect call weight percentiles (%s):\n", kind)
+	for i, p := range percentileRanks {
+		fmt.Fprintf(w, "\tp%g: %.0f\n", 100*p, values[i])
+	}
+}
+
+var weightStats = flag.Bool("stats", false, "print the mean, median, and standard deviation of indirect callsite hottest weight")
+
+// printWeightStats prints summary statistics of indirect callsite hottest
+// weight, computed in a single pass. The median is estimated as for large
+// inputs to -percentiles.
+func printWeightStats(w io.Writer, r *Result) {
+	var m moments
+	median := newP2Quantile(0.5)
+	for _, s := range r.Stats {
+		if s.Direct {
+			continue
+		}
+		m.add(float64(s.HottestWeight))
+		median.add(float64(s.HottestWeight))
+	}
+
+	fmt.Fprintf(w, "Indirect call hottest weight statistics (%d callsites):\n", m.n)
+	if m.n == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\tMean: %.2f\n", m.mean)
+	fmt.Fprintf(w, "\tMedian: %.0f (estimated)\n", median.value())
+	fmt.Fprintf(w, "\tStandard deviation: %.2f\n", m.stddev())
+}
+
+var concentration = flag.Bool("concentration", false, "print the Gini coefficient and top callsite shares of indirect hottest weight")
+
+// printConcentration summarizes how concentrated indirect call weight is
+// in a few callsites. High concentration means optimizing those few has
+// outsized impact.
+func printConcentration(w io.Writer, r *Result) {
+	var weights []float64
+	for _, s := range r.Stats {
+		if !s.Direct {
+			weights = append(weights, float64(s.HottestWeight))
+		}
+	}
+	sort.Float64s(weights)
+
+	fmt.Fprintf(w, "Indirect call hottest weight concentration:\n")
+	fmt.Fprintf(w, "\tGini coefficient: %.3f\n", gini(weights))
+	fmt.Fprintf(w, "\tTop 1%% of callsites: %.2f%% of weight\n", 100*topShare(weights, 0.01))
+	fmt.Fprintf(w, "\tTop 10%% of callsites: %.2f%% of weight\n", 100*topShare(weights, 0.10))
+}
+
+var topCallers = flag.Int("top-callers", 0, "print the share of indirect hottest weight in the calls made by the `N` caller functions with the most (10 if the section is selected by -sections)")
+
+// defaultTopCallers is the number of caller functions of the top-callers
+// section when it is selected by -sections rather than -top-callers.
+const defaultTopCallers = 10
+
+// printTopCallers prints how much indirect call weight the hottest caller
+// functions account for, to tell whether a few functions are worth
+// optimizing by hand.
+func printTopCallers(w io.Writer, r *Result) {
+	k := *topCallers
+	if k <= 0 {
+		k = defaultTopCallers
+	}
+	fmt.Fprintf(w, "Indirect call hottest weight by caller function:\n")
+	fmt.Fprintf(w, "\tTop %d caller functions: %.2f%% of weight\n", k, topCallersShare(r.Stats, k))
+}
+
+// topCallersShare returns the percentage of indirect hottest weight in
+// stats in the calls made by the k caller functions with the most.
+func topCallersShare(stats []CallStat, k int) float64 {
+	byCaller := make(map[string]int64)
+	var total int64
+	for _, s := range stats {
+		if !s.Direct {
+			byCaller[s.Caller] += s.HottestWeight
+			total += s.HottestWeight
 		}
-		fmt.Printf("\t(%s) (%s) %-40s -> %-40s (weight %d, %.2f%% of callsite weight)%s\t%s\n", spec, typ, s.Caller, s.Hottest, s.HottestWeight, pct(s.HottestWeight, s.Weight), specExtra, s.Pos)
-		for _, s := range inlined[s.Pos] {
-			fmt.Printf("\t\tinlined %s\n", s)
+	}
+	weights := make([]int64, 0, len(byCaller))
+	for _, w := range byCaller {
+		weights = append(weights, w)
+	}
+	sort.Slice(weights, func(i, j int) bool { return weights[i] > weights[j] })
+	var top int64
+	for _, w := range weights[:min(k, len(weights))] {
+		top += w
+	}
+	return pct(top, total)
+}
+
+var polymorphic = flag.Float64("polymorphic", 0, "print the average number of targets at polymorphic indirect calls, those whose hottest callee receives less than this `percent` of callsite weight (50 if the section is selected by -sections)")
+
+// defaultPolymorphic is the -polymorphic threshold of the polymorphism
+// section when it is selected by -sections rather than -polymorphic.
+const defaultPolymorphic = 50
+
+// printPolymorphism prints the average number of targets at polymorphic
+// callsites. Many targets per callsite suggest that single-target
+// devirtualization won't help much, and multi-target speculation might.
+//
+// pgodebug only records the hottest callee, so the number of targets is
+// estimated by its lower bound: no callee receives more weight than the
+// hottest, so there are at least Weight/HottestWeight of them.
+func printPolymorphism(w io.Writer, r *Result) {
+	threshold := *polymorphic
+	if threshold <= 0 {
+		threshold = defaultPolymorphic
+	}
+	var count int64
+	var targets, weightedTargets float64
+	var weight int64
+	for _, s := range r.Stats {
+		if s.Direct || s.HottestWeight <= 0 || hottestShare(s) >= threshold {
+			continue
 		}
+		n := math.Ceil(float64(s.Weight) / float64(s.HottestWeight))
+		count++
+		targets += n
+		weightedTargets += n * float64(s.Weight)
+		weight += s.Weight
+	}
+	fmt.Fprintf(w, "Polymorphic indirect calls (hottest < %.2f%% of callsite weight): %d (%s weight)\n", threshold, count, units(weight))
+	if count == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\tAverage targets per callsite: at least %.2f (%.2f weighted by callsite weight)\n", targets/float64(count), weightedTargets/float64(weight))
+}
 
-		printed++
-		topWeight += s.Weight
-		topHottestWeight += s.HottestWeight
+// printCallees prints the average number of callees of the indirect
+// callsites reporting NumCallees, if any do.
+func printCallees(w io.Writer, r *Result) {
+	var count, callees int64
+	for _, s := range r.Stats {
+		if s.Direct || s.NumCallees == 0 {
+			continue
+		}
+		count++
+		callees += s.NumCallees
+	}
+	if count == 0 {
+		return
 	}
-	fmt.Printf("Top %d weight: %d (%.2f%% of indirect weight)\n", topCount, topWeight, pct(topWeight, weight.indirectFunc+weight.indirectMethod))
-	fmt.Printf("Top %d hottest weight: %d (%.2f%% of indirect hottest weight)\n", topCount, topHottestWeight, pct(topHottestWeight, hottestWeight.indirectFunc+hottestWeight.indirectMethod))
+	fmt.Fprintf(w, "\tAverage callees per callsite: %.2f (%d of %d callsites report callees)\n", float64(callees)/float64(count), count, r.count.indirectFunc+r.count.indirectMethod)
+}
+
+// section is an independently printable part of the report.
+type section struct {
+	name  string
+	print func(w io.Writer, r *Result)
+
+	// If non-nil, the section is omitted by default and printed only
+	// when enabled returns true or it is named in -sections.
+	enabled func() bool
+}
+
+// whenSet returns a section enabled func for a section gated on a boolean
+// flag.
+func whenSet(b *bool) func() bool {
+	return func() bool { return *b }
+}
 
+// sections lists every report section in output order.
+var sections = []section{
+	{"counts", printCountBreakdown, nil},
+	{"weights", printWeightBreakdown, nil},
+	{"hottest", printHottestWeightBreakdown, nil},
+	{"sparkline", printSparkline, nil},
+	{"devirtualized", printDevirtualized, nil},
+	{"partition", printPartition, whenSet(partition)},
+	{"inlined", printInlinedNotDevirtualized, whenSet(inlinedCategory)},
+	{"inline-matrix", printInlineMatrix, whenSet(inlineMatrix)},
+	{"inlined-missed", printInlinedMissed, func() bool { return *inlinedMissed > 0 }},
+	{"missed", printMissedWeight, whenSet(topMissedWeight)},
+	{"near-miss", printNearMisses, func() bool { return *nearMiss > 0 }},
+	{"monomorphic", printMonomorphicMisses, whenSet(monomorphicMisses)},
+	{"percentiles", printPercentiles, whenSet(percentiles)},
+	{"stats", printWeightStats, whenSet(weightStats)},
+	{"concentration", printConcentration, whenSet(concentration)},
+	{"top-callers", printTopCallers, func() bool { return *topCallers > 0 }},
+	{"polymorphism", printPolymorphism, func() bool { return *polymorphic > 0 }},
+	{"topn", printTopN, nil},
+	{"top-by-package", printTopByPackage, func() bool { return *topByPackage > 0 }},
+	{"groups", printGroups, func() bool { return *groupBy != "" }},
+	{"by-interface", printByInterface, whenSet(byInterface)},
+	{"top-per-interface", printTopPerInterface, func() bool { return *topPerInterface > 0 }},
+	{"cross-package", printCrossPackage, whenSet(crossPackage)},
+	{"callees", printTopCallees, func() bool { return *topCallees > 0 }},
+	{"polymorphic-callers", printPolymorphicCallers, func() bool { return *polymorphicCallers > 0 }},
+	{"classes", printClasses, func() bool { return *classifyRules != "" }},
+	{"undevirtualized-packages", printUndevirtualizedPackages, whenSet(undevirtualizedPackages)},
+	{"diff", printDiff, func() bool { return *baseline != "" }},
+	{"ratio-regressions", printRatioRegressions, whenSet(ratioRegressions)},
+	{"diff-patch", printDiffPatch, whenSet(diffPatch)},
+	{"call-type-changes", printCallTypeChanges, whenSet(callTypeChanges)},
+	{"completeness", printCompleteness, whenSet(completeness)},
+	{"tags", printTags, whenSet(byTag)},
+}
+
+// sectionNames returns the names of all sections, or only of the sections
+// printed by default if defaults is set.
+func sectionNames(defaults bool) []string {
+	names := make([]string, 0, len(sections))
+	for _, s := range sections {
+		if defaults && s.enabled != nil {
+			continue
+		}
+		names = append(names, s.name)
+	}
+	return names
+}
+
+var sectionsFlag = flag.String("sections", strings.Join(sectionNames(true), ","), "comma-separated list of report sections to print")
+
+// selectedSections returns the sections named in -sections or enabled by
+// their own flag, in report order.
+func selectedSections() ([]section, error) {
+	want := make(map[string]bool)
+	for _, name := range strings.Split(*sectionsFlag, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		want[name] = true
+	}
+
+	var selected []section
+	for _, s := range sections {
+		if *diffOnly && !diffSections[s.name] {
+			delete(want, s.name)
+			continue
+		}
+		if want[s.name] || (s.enabled != nil && s.enabled()) {
+			selected = append(selected, s)
+		}
+		delete(want, s.name)
+	}
+	for name := range want {
+		return nil, fmt.Errorf("unknown section %q in -sections (want one of %s)", name, strings.Join(sectionNames(false), ", "))
+	}
+	return selected, nil
+}
+
+func run() error {
+	selected, err := selectedSections()
+	if err != nil {
+		return err
+	}
+	filters, err := buildFilters()
+	if err != nil {
+		return err
+	}
+	if _, err := reportTime(); err != nil {
+		return err
+	}
+	if err := checkProfileDate(); err != nil {
+		return err
+	}
+	if *diffOnly && *baseline == "" {
+		return errors.New("-diff-only requires -baseline")
+	}
+	if *outputDir != "" && (*templateFlag != "" || *format != "text" || *oneline) {
+		return errors.New("-output-dir writes the text report, and cannot be combined with -template, -format, or -oneline")
+	}
+	if *sqlitePath != "" {
+		if *format != "text" && *format != "sqlite" {
+			return fmt.Errorf("-sqlite cannot be combined with -format=%s", *format)
+		}
+		*format = "sqlite"
+	}
+	if *format == "sqlite" {
+		if *sqlitePath == "" {
+			return errors.New("-format=sqlite requires -sqlite to name the database file")
+		}
+		if *outputDir != "" || *templateFlag != "" || *oneline {
+			return errors.New("-format=sqlite replaces the report, and cannot be combined with -output-dir, -template, or -oneline")
+		}
+		if *deterministic && *sqliteRun == "" {
+			return errors.New("-sqlite with -deterministic requires -sqlite-run, as the default label is the report time")
+		}
+	}
+	if *quiet && *failUnder <= 0 {
+		return errors.New("-quiet requires -fail-under")
+	}
+	if *normalize && *totalWeight != 0 {
+		return errors.New("-total-weight is in raw profile units, and cannot be combined with -normalize-weights")
+	}
+	if *fromCache != "" && (len(inputFiles()) > 0 || *cachePath != "") {
+		return errors.New("-from-cache cannot be combined with -cache or input files")
+	}
+	if *fromCache != "" && *logSkipped != "" {
+		return errors.New("-from-cache has no input lines for -log-skipped")
+	}
+	if len(tops) > 0 && *topFraction > 0 {
+		return errors.New("-top and -top-fraction are mutually exclusive")
+	}
+	if *tiebreak != "" && *tiebreak != "devirt" {
+		return fmt.Errorf("unknown -tiebreak %q (want devirt)", *tiebreak)
+	}
+	if _, ok := groupKeys[*groupBy]; *groupBy != "" && !ok {
+		return fmt.Errorf("unknown -group-by %q (want package, caller, target, or file)", *groupBy)
+	}
+
+	tmpl, err := loadTemplate(selected)
+	if err != nil {
+		return err
+	}
+
+	if *watch {
+		return watchInput(func() error {
+			return analyze(tmpl, filters)
+		})
+	}
+	return analyze(tmpl, filters)
+}
+
+var inputFlag = flag.String("input", "", "read compiler output from `file` or http(s):// or s3:// URL rather than stdin; a .tar, .tar.gz, or .tgz file is read as an archive of logs, and a FIFO is read until every writer has closed it")
+
+// input is an input file and the tag it's reported under with -by-tag.
+type input struct {
+	tag  string
+	file string
+}
+
+// inputs returns the files to read: -input followed by any files named as
+// arguments. If empty, the input is stdin.
+//
+// With -by-tag, arguments may be given as TAG=FILE. Files without a tag are
+// tagged with their name.
+func inputs() []input {
+	var ins []input
+	if *inputFlag != "" {
+		ins = append(ins, input{*inputFlag, *inputFlag})
+	}
+	for _, arg := range flag.Args() {
+		in := input{arg, arg}
+		if tag, file, ok := strings.Cut(arg, "="); ok && *byTag {
+			in = input{tag, file}
+		}
+		ins = append(ins, in)
+	}
+	return ins
+}
+
+// inputFiles returns the names of the input files.
+func inputFiles() []string {
+	var files []string
+	for _, in := range inputs() {
+		files = append(files, in.file)
+	}
+	return files
+}
+
+// readInput reads and merges all of the input files.
+func readInput() (*Result, error) {
+	if *fromCache != "" {
+		return readFromCache()
+	}
+	ins := inputs()
+	if len(ins) == 0 {
+		r, err := readStatsCached(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		r.labelSkipped("stdin")
+		return r, nil
+	}
+	read := readStatsCached
+	if len(ins) > 1 && *cachePath != "" {
+		log.Printf("Ignoring -cache with multiple inputs")
+		read = func(f *os.File) (*Result, error) { return readStats(f) }
+	}
+
+	var r *Result
+	if *byTag {
+		// Keep each input's result intact for the per-tag summaries.
+		r = newResult()
+	}
+	for _, in := range ins {
+		var p *Result
+		var err error
+		if isURL(in.file) {
+			p, err = readURL(in.file)
+		} else {
+			var f *os.File
+			f, err = os.Open(in.file)
+			if err != nil {
+				return nil, err
+			}
+			if isArchive(in.file) {
+				p, err = readArchive(f, in.file)
+			} else {
+				p, err = read(f)
+			}
+			f.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", in.file, err)
+		}
+		p.labelSkipped(in.file)
+		if *byTag {
+			p.Tag = in.tag
+			r.Tagged = append(r.Tagged, p)
+		}
+		if r == nil {
+			r = p
+		} else {
+			r.mergeFile(p)
+		}
+	}
+	return r, nil
+}
+
+// mergeFile merges the result of reading another input file into r.
+func (r *Result) mergeFile(p *Result) {
+	r.Stats = append(r.Stats, p.Stats...)
+	merge := mergeInlined
+	if *keepInlineDups {
+		merge = appendInlined
+	}
+	merge(r.Inlined, p.Inlined)
+	merge(r.NotInlined, p.NotInlined)
+	r.Parse.add(&p.Parse)
+	r.skipped = append(r.skipped, p.skipped...)
+}
+
+// mergeInlined appends the symbols recorded at each position in src to
+// those in dst. Separate logs may well record the same inlining at the same
+// position (e.g., from rebuilding a package), so symbols already recorded at
+// a position in dst are not added again.
+func mergeInlined(dst, src map[string][]string) {
+	for pos, syms := range src {
+		seen := make(map[string]bool, len(dst[pos]))
+		for _, s := range dst[pos] {
+			seen[s] = true
+		}
+		for _, s := range syms {
+			if !seen[s] {
+				seen[s] = true
+				dst[pos] = append(dst[pos], s)
+			}
+		}
+	}
+}
+
+// appendInlined appends the symbols recorded at each position in src to
+// those in dst, keeping duplicates, for -keep-inline-dups.
+func appendInlined(dst, src map[string][]string) {
+	for pos, syms := range src {
+		dst[pos] = append(dst[pos], syms...)
+	}
+}
+
+var keepInlineDups = flag.Bool("keep-inline-dups", false, "list a call inlined at the same position more than once in a log or across input files (e.g., by separate compilation passes) once per occurrence rather than once")
+
+// dedupInlined removes repeated symbols at each position of the inlining
+// maps of r, keeping the first occurrence, unless -keep-inline-dups.
+func (r *Result) dedupInlined() {
+	if *keepInlineDups {
+		return
+	}
+	for _, m := range []map[string][]string{r.Inlined, r.NotInlined} {
+		for pos, syms := range m {
+			m[pos] = nil
+			mergeInlined(m, map[string][]string{pos: syms})
+		}
+	}
+}
+
+var normalize = flag.Bool("normalize-weights", false, "scale weights so that the heaviest callsite has weight 100, for comparing reports from profiles of different sizes; filters still see the raw weights")
+
+// normalizeWeights scales the weights of stats in place for
+// -normalize-weights.
+func normalizeWeights(stats []CallStat) {
+	if !*normalize {
+		return
+	}
+	var max int64
+	for _, s := range stats {
+		if s.Weight > max {
+			max = s.Weight
+		}
+	}
+	if max == 0 {
+		return
+	}
+	scale := func(w int64) int64 {
+		return int64(math.Round(float64(w) * 100 / float64(max)))
+	}
+	for i := range stats {
+		s := &stats[i]
+		s.Weight = scale(s.Weight)
+		s.HottestWeight = scale(s.HottestWeight)
+		s.DevirtualizedWeight = scale(s.DevirtualizedWeight)
+	}
+}
+
+// analyze reads the input and prints the report.
+func analyze(tmpl *template.Template, filters []filter) error {
+	restore := stopOnInterrupt()
+	resetMaxLines()
+	start := time.Now()
+	r, err := readInput()
+	elapsed := time.Since(start)
+	restore()
+	if err != nil {
+		return err
+	}
+	if *timing {
+		printTiming(os.Stderr, &r.Parse, elapsed)
+	}
+	if interrupted.Load() {
+		log.Printf("Interrupted; reporting on the input read so far")
+		r.Partial = true
+	}
+	if truncated.Load() {
+		log.Printf("Stopped reading input after -max-lines=%d lines; the report is truncated", *maxLines)
+		r.Partial = true
+	}
+	if *logSkipped != "" {
+		if err := writeSkipped(r); err != nil {
+			return err
+		}
+	}
+
+	if *validate {
+		printParseStats(os.Stdout, &r.Parse)
+		if r.Parse.StatLines == 0 {
+			return errors.New("no pgodebug call stats found in input")
+		}
+		return nil
+	}
+	if *parseStatsFlag {
+		printParseStats(os.Stderr, &r.Parse)
+	}
+	if *requireJSONRatio > 0 {
+		p := &r.Parse
+		var ratio float64
+		if nonBlank := p.Lines - p.Blank; nonBlank > 0 {
+			ratio = pct(p.StatLines, nonBlank)
+		}
+		if ratio < *requireJSONRatio {
+			return fmt.Errorf("only %.2f%% of non-blank input lines are pgodebug call stats, below -require-json-ratio=%g; is this the right log?", ratio, *requireJSONRatio)
+		}
+	}
+
+	r.dedupInlined()
+	r.Stats = collapseInstantiations(applyMinPercentile(applyFilters(r.Stats, filters)))
+	normalizeWeights(r.Stats)
+	if *classifyRules != "" {
+		r.Classifier, err = loadClassifier(*classifyRules)
+		if err != nil {
+			return err
+		}
+	}
+	r.summarize()
+	for _, t := range r.Tagged {
+		t.dedupInlined()
+		t.Stats = collapseInstantiations(applyMinPercentile(applyFilters(t.Stats, filters)))
+		normalizeWeights(t.Stats)
+		t.summarize()
+	}
+	if *baseline != "" {
+		r.Baseline, err = readBaseline(*baseline, filters)
+		if err != nil {
+			return err
+		}
+	}
+	if !r.devirtDetail() {
+		// Rather than pass or fail on a devirtualization rate of 0.
+		switch {
+		case *failUnder > 0:
+			return errors.New("-fail-under requires devirtualization detail, which the input lacks (from -d=pgodebug=2?)")
+		case *expectFile != "":
+			return errors.New("-expect requires devirtualization detail, which the input lacks (from -d=pgodebug=2?)")
+		case *oneline:
+			return errors.New("-oneline requires devirtualization detail, which the input lacks (from -d=pgodebug=2?)")
+		}
+	}
+	if *quiet {
+		// -quiet replaces the report, not the -expect check.
+		var expectErr error
+		if *expectFile != "" {
+			expectErr = checkExpected(os.Stderr, r)
+			if expectErr != nil && !errors.Is(expectErr, errExpectFailed) {
+				return expectErr
+			}
+		}
+		return errors.Join(expectErr, gate(os.Stdout, r))
+	}
+	if err := report(tmpl, r); err != nil {
+		return err
+	}
+	if *expectFile != "" {
+		if err := checkExpected(os.Stderr, r); err != nil {
+			return err
+		}
+	}
+	if *failUnder > 0 {
+		// Keep the verdict out of machine-readable output.
+		return gate(os.Stderr, r)
+	}
 	return nil
 }
 
+// report prints the report for r in the selected format.
+func report(tmpl *template.Template, r *Result) error {
+	if *oneline {
+		printOneline(os.Stdout, r)
+		return nil
+	}
+	switch *format {
+	case "text":
+	case "json":
+		return writeJSON(os.Stdout, r)
+	case "tsv":
+		return writeTSV(os.Stdout, r)
+	case "opportunities":
+		return writeOpportunities(os.Stdout, r)
+	case "sqlite":
+		return writeSQLite(r)
+	default:
+		return fmt.Errorf("unknown -format %q (want text, json, tsv, opportunities, or sqlite)", *format)
+	}
+	if *outputDir != "" {
+		return writeOutputDir(r)
+	}
+	if r.Partial {
+		fmt.Fprintf(os.Stdout, "PARTIAL: input reading stopped early; this report covers only the input read before then.\n\n")
+	}
+	if !r.devirtDetail() {
+		log.Printf("Input lacks devirtualization detail (from -d=pgodebug=2?); omitting devirtualization sections")
+	}
+	if *header {
+		printHeader(os.Stdout, buildMetadata())
+	}
+	return execTemplate(os.Stdout, tmpl, r)
+}
+
+var printSchema = flag.Bool("print-schema", false, "print the fields of the pgodebug call stat JSON this tool expects, and exit")
+
+// writeSchema prints the JSON fields of CallStat and their types, for
+// comparison against what a compiler emits.
+func writeSchema(w io.Writer) {
+	t := reflect.TypeOf(CallStat{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if n, _, _ := strings.Cut(tag, ","); n != "" {
+				name = n
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, f.Type)
+	}
+}
+
+// envPrefix prefixes the environment variables holding flag defaults.
+const envPrefix = "PGO_ANALYSIS_"
+
+// envName returns the environment variable holding the default for flag
+// name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setFlagsFromEnv sets each flag not given on the command line from its
+// environment variable, if set.
+func setFlagsFromEnv() error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	// A flag and its alias share a value, so setting either on the
+	// command line sets both.
+	for alias, name := range flagAliases {
+		if explicit[alias] || explicit[name] {
+			explicit[alias], explicit[name] = true, true
+		}
+	}
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || explicit[f.Name] || err != nil {
+			return
+		}
+		if e := flag.Set(f.Name, v); e != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", v, envName(f.Name), e)
+		}
+	})
+	return err
+}
+
 func main() {
 	flag.Parse()
+	if err := setFlagsFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+	if *printSchema {
+		writeSchema(os.Stdout)
+		return
+	}
 
 	if err := run(); err != nil {
+		if errors.Is(err, errGateFailed) || errors.Is(err, errExpectFailed) {
+			// gate or checkExpected already explained.
+			os.Exit(1)
+		}
 		log.Fatal(err)
 	}
 }
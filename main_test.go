@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Generic instantiations can produce pgodebug lines longer than the 64KB
+// default limit of bufio.Scanner.
+func TestReadStatsLongLine(t *testing.T) {
+	want := CallStat{
+		Pkg:           "example.com/foo",
+		Pos:           "/src/foo.go:10:5",
+		Caller:        "foo.F[" + strings.Repeat("go.shape.int,", 10_000) + "]",
+		Interface:     true,
+		Weight:        100,
+		Hottest:       "bar.(*T).M",
+		HottestWeight: 90,
+	}
+	line, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(line) <= 64<<10 {
+		t.Fatalf("test line is only %d bytes", len(line))
+	}
+
+	in := "# example.com/foo\n" + string(line) + "\n"
+	r, err := readStats(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("readStats: %v", err)
+	}
+	if len(r.Stats) != 1 {
+		t.Fatalf("got %d stats, want 1", len(r.Stats))
+	}
+	if r.Stats[0] != want {
+		t.Errorf("got stat with caller of %d bytes, want %d", len(r.Stats[0].Caller), len(want.Caller))
+	}
+}
+
+func TestMergeInlined(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		dst, src map[string][]string
+		want     map[string][]string
+	}{
+		{
+			name: "disjoint",
+			dst:  map[string][]string{"a.go:1:1": {"x.F"}},
+			src:  map[string][]string{"b.go:2:1": {"y.G", "y.H"}},
+			want: map[string][]string{"a.go:1:1": {"x.F"}, "b.go:2:1": {"y.G", "y.H"}},
+		},
+		{
+			name: "overlapping",
+			dst:  map[string][]string{"a.go:1:1": {"x.F", "x.G"}},
+			src:  map[string][]string{"a.go:1:1": {"x.G", "x.H", "x.F"}},
+			want: map[string][]string{"a.go:1:1": {"x.F", "x.G", "x.H"}},
+		},
+		{
+			name: "order",
+			dst:  map[string][]string{"a.go:1:1": {"x.C"}},
+			src:  map[string][]string{"a.go:1:1": {"x.B", "x.A", "x.B"}},
+			want: map[string][]string{"a.go:1:1": {"x.C", "x.B", "x.A"}},
+		},
+		{
+			name: "empty dst",
+			dst:  map[string][]string{},
+			src:  map[string][]string{"a.go:1:1": {"x.F", "x.F"}},
+			want: map[string][]string{"a.go:1:1": {"x.F"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mergeInlined(tc.dst, tc.src)
+			if !reflect.DeepEqual(tc.dst, tc.want) {
+				t.Errorf("got %v, want %v", tc.dst, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeFileKeepInlineDups(t *testing.T) {
+	defer func(v bool) { *keepInlineDups = v }(*keepInlineDups)
+	for _, keep := range []bool{false, true} {
+		*keepInlineDups = keep
+		r, p := newResult(), newResult()
+		r.Inlined["a.go:1:1"] = []string{"x.F"}
+		p.Inlined["a.go:1:1"] = []string{"x.F", "x.G"}
+		p.NotInlined["a.go:2:1"] = []string{"x.H"}
+		r.mergeFile(p)
+
+		want := []string{"x.F", "x.G"}
+		if keep {
+			want = []string{"x.F", "x.F", "x.G"}
+		}
+		if got := r.Inlined["a.go:1:1"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("-keep-inline-dups=%v: got inlined %v, want %v", keep, got, want)
+		}
+		if got, want := r.NotInlined["a.go:2:1"], []string{"x.H"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("-keep-inline-dups=%v: got not inlined %v, want %v", keep, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var modulePath = flag.String("module-path", "", "tag callsites and packages as belonging to the main module with this `path`, a dependency, or the standard library")
+
+// moduleOf returns whether package pkg is in the -module-path module
+// ("main"), the standard library ("std"), or another module ("dependency").
+// It returns "" without -module-path.
+func moduleOf(pkg string) string {
+	mp := *modulePath
+	switch {
+	case mp == "":
+		return ""
+	case pkg == mp || strings.HasPrefix(pkg, mp+"/"):
+		return "main"
+	case pkg == "main":
+		// The compiler reports command packages as "main", which is
+		// most likely the binary being built from the main module.
+		return "main"
+	case !strings.Contains(strings.SplitN(pkg, "/", 2)[0], "."):
+		// As in cmd/go, standard library import paths have no dot in
+		// their first element.
+		return "std"
+	default:
+		return "dependency"
+	}
+}
+
+// moduleTag returns a suffix marking the module of pkg in text output.
+func moduleTag(pkg string) string {
+	if m := moduleOf(pkg); m != "" {
+		return " [" + m + "]"
+	}
+	return ""
+}
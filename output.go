@@ -0,0 +1,185 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var format = flag.String("format", "text", "output format: text, json, tsv, opportunities, or sqlite. json and tsv list every indirect callsite, hottest first. opportunities lists missed interface devirtualizations as JSON lines. sqlite writes every callsite to the SQLite database named by -sqlite")
+
+// callsiteID returns a short identifier for the callsite of s that is
+// stable across runs, even as weights change.
+func callsiteID(s CallStat) string {
+	h := sha256.New()
+	// NUL cannot appear in any of the fields, so it unambiguously
+	// separates them.
+	fmt.Fprintf(h, "%s\x00%s\x00%s", s.Pkg, normalizePos(s.Pos), s.Caller)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// Callsite is the per-callsite record of the structured output formats.
+type Callsite struct {
+	ID string
+	CallStat
+
+	// HottestShare is HottestWeight as a percentage of Weight, as
+	// shown in the text top-N list.
+	HottestShare float64
+
+	// Inlined reports whether there are inlined calls at the callsite's
+	// position, listed in InlinedSymbols. NotInlined lists the calls that
+	// -m reported could not be inlined there.
+	Inlined        bool
+	InlinedSymbols []string `json:",omitempty"`
+	NotInlined     []string `json:",omitempty"`
+
+	// Module is "main", "dependency", or "std", with -module-path.
+	Module string `json:",omitempty"`
+}
+
+// hottestShare returns the percentage of the callsite weight going to the
+// hottest callee, or 0 for a callsite without weight.
+func hottestShare(s CallStat) float64 {
+	if s.Weight == 0 {
+		return 0
+	}
+	return pct(s.HottestWeight, s.Weight)
+}
+
+// indirectCallsites returns the indirect callsites in r, hottest first.
+func indirectCallsites(r *Result) []Callsite {
+	stats := sortedByHottest(r.Stats)
+	var sites []Callsite
+	for i := len(stats) - 1; i >= 0; i-- {
+		s := stats[i]
+		if s.Direct {
+			continue
+		}
+		c := Callsite{
+			ID:             callsiteID(s),
+			CallStat:       s,
+			HottestShare:   hottestShare(s),
+			Inlined:        len(r.Inlined[s.Pos]) > 0,
+			InlinedSymbols: r.Inlined[s.Pos],
+			NotInlined:     r.NotInlined[s.Pos],
+			Module:         moduleOf(s.Pkg),
+		}
+		c.Pos = displayPos(s.Pos)
+		sites = append(sites, c)
+	}
+	return sites
+}
+
+// JSONOutput is the top-level object written by -format=json.
+type JSONOutput struct {
+	GeneratedAt string    `json:",omitempty"` // RFC 3339; omitted with -deterministic
+	Inputs      []string  // input files, or "stdin"
+	Metadata    *Metadata `json:",omitempty"` // only with -header
+	Partial     bool      `json:",omitempty"` // not all input was read
+	ProfileDate string    `json:",omitempty"` // from -profile-date
+	Callsites   []Callsite
+}
+
+func writeJSON(w io.Writer, r *Result) error {
+	// -timestamp is validated at startup.
+	t, _ := reportTime()
+	out := JSONOutput{
+		Inputs:      inputNames(),
+		Partial:     r.Partial,
+		ProfileDate: *profileDate,
+		Callsites:   indirectCallsites(r),
+	}
+	if !*deterministic {
+		out.GeneratedAt = t.Format(time.RFC3339)
+	}
+	if *header {
+		out.Metadata = buildMetadata()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
+}
+
+var tsvColumns = []string{"ID", "Pkg", "Pos", "Caller", "Interface", "Weight", "Hottest", "HottestWeight", "HottestShare", "Devirtualized", "DevirtualizedWeight"}
+
+func writeTSV(w io.Writer, r *Result) error {
+	if _, err := fmt.Fprintln(w, strings.Join(tsvColumns, "\t")); err != nil {
+		return err
+	}
+	for _, c := range indirectCallsites(r) {
+		row := []string{
+			c.ID,
+			c.Pkg,
+			c.Pos,
+			c.Caller,
+			strconv.FormatBool(c.Interface),
+			strconv.FormatInt(c.Weight, 10),
+			c.Hottest,
+			strconv.FormatInt(c.HottestWeight, 10),
+			strconv.FormatFloat(c.HottestShare, 'f', 2, 64),
+			c.Devirtualized,
+			strconv.FormatInt(c.DevirtualizedWeight, 10),
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var opportunityMinWeight = flag.Int64("opportunity-min-weight", 0, "minimum hottest callee weight for -format=opportunities")
+
+// Opportunity is an interface callsite that was not devirtualized even
+// though a single callee dominates it, as written by
+// -format=opportunities.
+type Opportunity struct {
+	ID            string
+	Pos           string
+	Caller        string
+	Hottest       string
+	Weight        int64
+	HottestWeight int64
+
+	// Concentration is HottestWeight / Weight.
+	Concentration float64
+}
+
+// writeOpportunities writes one JSON object per line for each interface
+// callsite that was not devirtualized, has a hottest callee weight of at
+// least -opportunity-min-weight, and a concentration of at least
+// -missed-threshold.
+func writeOpportunities(w io.Writer, r *Result) error {
+	enc := json.NewEncoder(w)
+	for _, c := range indirectCallsites(r) {
+		if !c.Interface || c.Devirtualized != "" {
+			continue
+		}
+		if c.HottestWeight < *opportunityMinWeight || c.HottestShare < *missedThreshold {
+			continue
+		}
+		o := Opportunity{
+			ID:            c.ID,
+			Pos:           c.Pos,
+			Caller:        c.Caller,
+			Hottest:       c.Hottest,
+			Weight:        c.Weight,
+			HottestWeight: c.HottestWeight,
+			Concentration: c.HottestShare / 100,
+		}
+		if err := enc.Encode(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
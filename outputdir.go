@@ -0,0 +1,95 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var outputDir = flag.String("output-dir", "", "write the text report to separate files in `dir`: summary.txt for the call breakdowns, top.txt for the top-N lists, packages.txt for per-package tables (including -group-by package), and NAME.txt for any other section")
+
+// sectionFiles are the -output-dir files of sections not written to
+// NAME.txt.
+var sectionFiles = map[string]string{
+	"counts":                   "summary.txt",
+	"weights":                  "summary.txt",
+	"hottest":                  "summary.txt",
+	"sparkline":                "summary.txt",
+	"devirtualized":            "summary.txt",
+	"partition":                "summary.txt",
+	"topn":                     "top.txt",
+	"top-by-package":           "packages.txt",
+	"undevirtualized-packages": "packages.txt",
+	"completeness":             "packages.txt",
+}
+
+// writeOutputDir writes the selected sections of the report for r to their
+// files in -output-dir. The header, if any, goes in summary.txt.
+func writeOutputDir(r *Result) (err error) {
+	selected, err := selectedSections()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outputDir, 0o777); err != nil {
+		return err
+	}
+
+	type file struct {
+		f *os.File
+		w *bufio.Writer
+	}
+	files := make(map[string]*file)
+	defer func() {
+		for _, f := range files {
+			err = errors.Join(err, f.w.Flush(), f.f.Close())
+		}
+	}()
+	open := func(name string) (*file, error) {
+		if f, ok := files[name]; ok {
+			return f, nil
+		}
+		f, err := os.Create(filepath.Join(*outputDir, name))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = &file{f, bufio.NewWriter(f)}
+		return files[name], nil
+	}
+
+	summary, err := open("summary.txt")
+	if err != nil {
+		return err
+	}
+	if r.Partial {
+		fmt.Fprintf(summary.w, "PARTIAL: input reading stopped early; this report covers only the input read before then.\n\n")
+	}
+	if *header {
+		printHeader(summary.w, buildMetadata())
+	}
+	for _, s := range selected {
+		if devirtSections[s.name] && !r.devirtDetail() {
+			continue
+		}
+		name, ok := sectionFiles[s.name]
+		switch {
+		case s.name == "groups" && *groupBy == "package":
+			// Grouped by package, it is another per-package table.
+			name = "packages.txt"
+		case !ok:
+			name = s.name + ".txt"
+		}
+		f, err := open(name)
+		if err != nil {
+			return err
+		}
+		s.print(f.w, r)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"runtime"
+)
+
+var parallel = flag.Int("parallel", runtime.GOMAXPROCS(0), "number of goroutines parsing input; 1 parses sequentially")
+
+// linesPerChunk is the number of lines handed to a parse worker at once.
+const linesPerChunk = 4096
+
+// parseChunk is a run of consecutive input lines parsed by one worker.
+type parseChunk struct {
+	lines [][]byte
+	done  chan *Result
+}
+
+// readStatsParallel is readStats, parsing with n workers. Chunks are merged
+// in input order, so the result is identical to a sequential parse.
+func readStatsParallel(in io.Reader, n int, dir string) (*Result, error) {
+	work := make(chan *parseChunk, n)
+	order := make(chan *parseChunk, 2*n)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			for c := range work {
+				p := newResult()
+				p.dir = dir
+				for _, line := range c.lines {
+					p.parseLine(line)
+				}
+				c.done <- p
+			}
+		}()
+	}
+
+	var readErr error
+	go func() {
+		defer close(order)
+		defer close(work)
+
+		var lines [][]byte
+		flush := func() {
+			c := &parseChunk{lines: lines, done: make(chan *Result, 1)}
+			work <- c
+			order <- c
+			lines = nil
+		}
+		readErr = forEachLine(in, func(line []byte) {
+			lines = append(lines, line)
+			if len(lines) == linesPerChunk {
+				flush()
+			}
+		})
+		if len(lines) > 0 {
+			flush()
+		}
+	}()
+
+	r := newResult()
+	for c := range order {
+		r.merge(<-c.done)
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return r, nil
+}
+
+// merge appends the results parsed from later input in p to r.
+func (r *Result) merge(p *Result) {
+	r.Stats = append(r.Stats, p.Stats...)
+	// Line numbers in p count from the start of its chunk.
+	for _, s := range p.skipped {
+		s.line += r.Parse.Lines
+		r.skipped = append(r.skipped, s)
+	}
+	for pos, syms := range p.Inlined {
+		r.Inlined[pos] = append(r.Inlined[pos], syms...)
+	}
+	for pos, syms := range p.NotInlined {
+		r.NotInlined[pos] = append(r.NotInlined[pos], syms...)
+	}
+	r.Parse.add(&p.Parse)
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parallelTestInput returns a log spanning several parse chunks, mixing call
+// stats with inlining diagnostics at positions recurring across chunks and
+// lines the parser skips.
+func parallelTestInput() string {
+	var b strings.Builder
+	for i := 0; i < 3*linesPerChunk+123; i++ {
+		pos := fmt.Sprintf("/src/f%d.go:%d:3", i%7, i%50)
+		switch i % 5 {
+		case 0:
+			fmt.Fprintf(&b, "# example.com/p%d\n", i)
+		case 1:
+			fmt.Fprintf(&b, "%s: inlining call to p.f%d\n", pos, i)
+		case 2:
+			fmt.Fprintf(&b, "%s: cannot inline p.g%d: function too complex\n", pos, i)
+		case 3:
+			fmt.Fprintln(&b)
+		default:
+			fmt.Fprintf(&b, `{"Pkg":"example.com/p","Pos":%q,"Caller":"p.c%d","Direct":false,"Interface":%t,"Weight":%d,"Hottest":"p.h","HottestWeight":%d,"Devirtualized":"","DevirtualizedWeight":0}`+"\n", pos, i, i%2 == 0, i, i/2)
+		}
+	}
+	return b.String()
+}
+
+func TestReadStatsParallelMatchesSequential(t *testing.T) {
+	defer func(p int, m bool, l string) { *parallel, *mFlag, *logSkipped = p, m, l }(*parallel, *mFlag, *logSkipped)
+	*mFlag = true
+	*logSkipped = "unused" // record skipped lines to compare them too
+	in := parallelTestInput()
+
+	*parallel = 1
+	want, err := readStats(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Parse.Lines <= 3*linesPerChunk {
+		t.Fatalf("input has only %d lines, want several chunks", want.Parse.Lines)
+	}
+
+	for _, n := range []int{2, 3, 8} {
+		*parallel = n
+		got, err := readStats(strings.NewReader(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("-parallel=%d result differs from -parallel=1", n)
+			if got.Parse != want.Parse {
+				t.Errorf("parse stats: got %+v, want %+v", got.Parse, want.Parse)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// exactQuantile returns the p-quantile (0 < p <= 1) of sorted using the
+// nearest-rank method.
+func exactQuantile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// p2Quantile estimates a single quantile of a stream of observations in
+// constant space using the P² algorithm of Jain and Chlamtac, "The P²
+// algorithm for dynamic calculation of quantiles and histograms without
+// storing observations", CACM 28(10), 1985.
+type p2Quantile struct {
+	p float64
+	n int
+
+	q   [5]float64 // marker heights
+	pos [5]float64 // marker positions, 1-based
+	des [5]float64 // desired marker positions
+	inc [5]float64 // desired position increment per observation
+}
+
+func newP2Quantile(p float64) *p2Quantile {
+	return &p2Quantile{p: p}
+}
+
+func (e *p2Quantile) add(x float64) {
+	if e.n < 5 {
+		e.q[e.n] = x
+		e.n++
+		if e.n == 5 {
+			sort.Float64s(e.q[:])
+			p := e.p
+			e.pos = [5]float64{1, 2, 3, 4, 5}
+			e.des = [5]float64{1, 1 + 2*p, 1 + 4*p, 3 + 2*p, 5}
+			e.inc = [5]float64{0, p / 2, p, (1 + p) / 2, 1}
+		}
+		return
+	}
+	e.n++
+
+	// Find the cell containing x, extending the extreme markers if
+	// necessary.
+	var k int
+	switch {
+	case x < e.q[0]:
+		e.q[0] = x
+		k = 0
+	case x >= e.q[4]:
+		e.q[4] = x
+		k = 3
+	default:
+		for k = 0; k < 3; k++ {
+			if x < e.q[k+1] {
+				break
+			}
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		e.pos[i]++
+	}
+	for i := range e.des {
+		e.des[i] += e.inc[i]
+	}
+
+	// Adjust the middle markers toward their desired positions.
+	for i := 1; i <= 3; i++ {
+		d := e.des[i] - e.pos[i]
+		if (d >= 1 && e.pos[i+1]-e.pos[i] > 1) || (d <= -1 && e.pos[i-1]-e.pos[i] < -1) {
+			s := math.Copysign(1, d)
+			q := e.parabolic(i, s)
+			if e.q[i-1] < q && q < e.q[i+1] {
+				e.q[i] = q
+			} else {
+				e.q[i] = e.linear(i, s)
+			}
+			e.pos[i] += s
+		}
+	}
+}
+
+func (e *p2Quantile) parabolic(i int, d float64) float64 {
+	q, n := &e.q, &e.pos
+	return q[i] + d/(n[i+1]-n[i-1])*((n[i]-n[i-1]+d)*(q[i+1]-q[i])/(n[i+1]-n[i])+(n[i+1]-n[i]-d)*(q[i]-q[i-1])/(n[i]-n[i-1]))
+}
+
+func (e *p2Quantile) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return e.q[i] + d*(e.q[j]-e.q[i])/(e.pos[j]-e.pos[i])
+}
+
+// value returns the current estimate. With fewer than five observations it
+// is exact.
+func (e *p2Quantile) value() float64 {
+	if e.n < 5 {
+		sorted := append([]float64(nil), e.q[:e.n]...)
+		sort.Float64s(sorted)
+		return exactQuantile(sorted, e.p)
+	}
+	return e.q[2]
+}
+
+// gini returns the Gini coefficient of sorted, which must be in increasing
+// order: 0 if all values are equal, approaching 1 as a single value
+// dominates.
+func gini(sorted []float64) float64 {
+	n := float64(len(sorted))
+	var sum, weighted float64
+	for i, x := range sorted {
+		sum += x
+		weighted += float64(i+1) * x
+	}
+	if sum == 0 {
+		return 0
+	}
+	return 2*weighted/(n*sum) - (n+1)/n
+}
+
+// topShare returns the fraction of the total of sorted, which must be in
+// increasing order, held by the largest frac of values.
+func topShare(sorted []float64, frac float64) float64 {
+	k := int(math.Ceil(frac * float64(len(sorted))))
+	var top, sum float64
+	for i, x := range sorted {
+		sum += x
+		if i >= len(sorted)-k {
+			top += x
+		}
+	}
+	if sum == 0 {
+		return 0
+	}
+	return top / sum
+}
+
+// moments accumulates the mean and variance of a stream of observations in
+// a single numerically stable pass, using Welford's algorithm.
+type moments struct {
+	n    int
+	mean float64
+	m2   float64 // sum of squared differences from the mean
+}
+
+func (m *moments) add(x float64) {
+	m.n++
+	d := x - m.mean
+	m.mean += d / float64(m.n)
+	m.m2 += d * (x - m.mean)
+}
+
+// stddev returns the population standard deviation of the observations.
+func (m *moments) stddev() float64 {
+	if m.n == 0 {
+		return 0
+	}
+	return math.Sqrt(m.m2 / float64(m.n))
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+)
+
+var logSkipped = flag.String("log-skipped", "", "write each input line the parser did not recognize to `file`, prefixed with its input file and line number")
+
+// skippedLine is an input line the parser did not recognize, recorded for
+// -log-skipped.
+type skippedLine struct {
+	file string // input file, or "" until known
+	line int64  // 1-based line number in file
+	text string
+}
+
+// labelSkipped sets the input file of the skipped lines in r not yet
+// attributed to one.
+func (r *Result) labelSkipped(file string) {
+	for i := range r.skipped {
+		if r.skipped[i].file == "" {
+			r.skipped[i].file = file
+		}
+	}
+}
+
+// writeSkipped writes the skipped lines of r to the -log-skipped file.
+func writeSkipped(r *Result) error {
+	f, err := os.Create(*logSkipped)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, s := range r.skipped {
+		fmt.Fprintf(w, "%s:%d: %s\n", s.file, s.line, s.text)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go, so no cgo is needed
+)
+
+var (
+	sqlitePath    = flag.String("sqlite", "", "export every parsed callsite and inlined call to the SQLite database `file` for ad-hoc queries, instead of printing a report; implies -format=sqlite. Each export is a run, labeled by -sqlite-run, and runs accumulate in the database")
+	sqliteRun     = flag.String("sqlite-run", "", "`label` of the rows of this -sqlite export, such as a build ID (default the report time, as set by -timestamp; required with -deterministic)")
+	sqliteReplace = flag.Bool("sqlite-replace", false, "replace the rows of an earlier -sqlite export with the same -sqlite-run label, rather than failing")
+)
+
+// sqliteSchema creates the tables of a -sqlite export, unless they exist
+// from exporting another run. Positions are as printed in the text report,
+// and join the two tables. run distinguishes the rows of each export.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS callsites (
+		run TEXT,
+		input TEXT,
+		id TEXT,
+		pkg TEXT,
+		pos TEXT,
+		caller TEXT,
+		direct INTEGER,
+		interface INTEGER,
+		weight INTEGER,
+		hottest TEXT,
+		hottest_weight INTEGER,
+		devirtualized TEXT,
+		devirtualized_weight INTEGER,
+		num_callees INTEGER, -- NULL if unknown
+		hottest_share REAL, -- percentage of weight
+		inlined INTEGER -- number of calls inlined at pos
+	)`,
+	`CREATE INDEX IF NOT EXISTS callsites_pkg ON callsites (pkg)`,
+	`CREATE INDEX IF NOT EXISTS callsites_weight ON callsites (weight)`,
+	`CREATE INDEX IF NOT EXISTS callsites_run ON callsites (run)`,
+	`CREATE TABLE IF NOT EXISTS inlined (
+		run TEXT,
+		input TEXT,
+		pos TEXT,
+		seq INTEGER, -- order of the call among those inlined at pos
+		symbol TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS inlined_pos ON inlined (pos)`,
+	`CREATE INDEX IF NOT EXISTS inlined_run ON inlined (run)`,
+}
+
+// sqliteRunLabel returns the label of the rows of this export.
+func sqliteRunLabel() string {
+	if *sqliteRun != "" {
+		return *sqliteRun
+	}
+	// -timestamp is validated at startup.
+	t, _ := reportTime()
+	return t.Format(time.RFC3339Nano)
+}
+
+// writeSQLite exports r to the -sqlite database.
+func writeSQLite(r *Result) error {
+	db, err := sql.Open("sqlite", *sqlitePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := exportSQLite(tx, r); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func exportSQLite(tx *sql.Tx, r *Result) error {
+	for _, stmt := range sqliteSchema {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	run := sqliteRunLabel()
+	if *sqliteReplace {
+		for _, table := range []string{"callsites", "inlined"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE run = ?", run); err != nil {
+				return err
+			}
+		}
+	} else {
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM callsites WHERE run = ?", run).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%s already has run %q; use -sqlite-replace to replace it", *sqlitePath, run)
+		}
+	}
+	input := strings.Join(inputNames(), ", ")
+
+	insert, err := tx.Prepare("INSERT INTO callsites VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, s := range r.Stats {
+		var callees any // NULL
+		if s.NumCallees > 0 {
+			callees = s.NumCallees
+		}
+		if _, err := insert.Exec(run, input, callsiteID(s), s.Pkg, displayPos(s.Pos), s.Caller,
+			s.Direct, s.Interface, s.Weight, s.Hottest, s.HottestWeight,
+			s.Devirtualized, s.DevirtualizedWeight, callees, hottestShare(s), len(r.Inlined[s.Pos])); err != nil {
+			return err
+		}
+	}
+
+	insert, err = tx.Prepare("INSERT INTO inlined VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	positions := make([]string, 0, len(r.Inlined))
+	for pos := range r.Inlined {
+		positions = append(positions, pos)
+	}
+	sort.Strings(positions)
+	for _, pos := range positions {
+		for i, sym := range r.Inlined[pos] {
+			if _, err := insert.Exec(run, input, displayPos(pos), i, sym); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
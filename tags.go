@@ -0,0 +1,60 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+var byTag = flag.Bool("by-tag", false, "summarize each input file separately in a side-by-side table; files may be named TAG=FILE to label their column, e.g. go1.22=build.log")
+
+// printTags prints a table comparing the summaries of each tagged input,
+// such as builds with successive Go releases.
+func printTags(w io.Writer, r *Result) {
+	if len(r.Tagged) == 0 {
+		return
+	}
+
+	rows := []struct {
+		label string
+		value func(t *Result) string
+	}{
+		{"Indirect calls", func(t *Result) string {
+			return fmt.Sprint(t.count.indirectFunc + t.count.indirectMethod)
+		}},
+		{"Indirect weight", func(t *Result) string {
+			return units(t.weight.indirectFunc + t.weight.indirectMethod)
+		}},
+		{"Devirtualized calls", func(t *Result) string {
+			return fmt.Sprint(t.devirtualizedCount.indirectFunc + t.devirtualizedCount.indirectMethod)
+		}},
+		{"Devirtualized weight", func(t *Result) string {
+			return units(t.devirtualizedWeight.indirectFunc + t.devirtualizedWeight.indirectMethod)
+		}},
+		{"Devirtualized % of indirect weight", func(t *Result) string {
+			return fmt.Sprintf("%.2f%%", pct(t.devirtualizedWeight.indirectFunc+t.devirtualizedWeight.indirectMethod, t.weight.indirectFunc+t.weight.indirectMethod))
+		}},
+	}
+
+	fmt.Fprintf(w, "\nSummary by tag:\n")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	tags := make([]string, 0, len(r.Tagged))
+	for _, t := range r.Tagged {
+		tags = append(tags, t.Tag)
+	}
+	fmt.Fprintf(tw, "\t\t%s\t\n", strings.Join(tags, "\t"))
+	for _, row := range rows {
+		fmt.Fprintf(tw, "\t%s\t", row.label)
+		for _, t := range r.Tagged {
+			fmt.Fprintf(tw, "%s\t", row.value(t))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
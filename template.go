@@ -0,0 +1,131 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+)
+
+var templateFlag = flag.String("template", "", "format the text report with the Go text/template in `file`, executed against the Result")
+
+// defaultTemplate is the built-in text report layout: each selected
+// section in order.
+const defaultTemplate = `{{range sections}}{{section .}}{{end}}`
+
+// Breakdown is a sum split by call type, for use in templates.
+type Breakdown struct {
+	Direct         int64
+	IndirectFunc   int64
+	IndirectMethod int64
+	Total          int64
+}
+
+func (s *sum) breakdown() Breakdown {
+	return Breakdown{
+		Direct:         s.direct,
+		IndirectFunc:   s.indirectFunc,
+		IndirectMethod: s.indirectMethod,
+		Total:          s.total(),
+	}
+}
+
+// Summary holds the aggregate totals of a Result, for use in templates.
+type Summary struct {
+	Count               Breakdown
+	Weight              Breakdown
+	HottestWeight       Breakdown
+	DevirtualizedCount  Breakdown
+	DevirtualizedWeight Breakdown
+
+	// DevirtualizedInlinedWeight is the devirtualized weight of calls with
+	// inlined calls at the same position.
+	DevirtualizedInlinedWeight Breakdown
+
+	// Classes holds the totals of each class, if the Result has a
+	// Classifier.
+	Classes map[string]Summary
+}
+
+// Summary returns the aggregate totals of r.
+func (r *Result) Summary() Summary {
+	s := Summary{
+		Count:               r.count.breakdown(),
+		Weight:              r.weight.breakdown(),
+		HottestWeight:       r.hottestWeight.breakdown(),
+		DevirtualizedCount:  r.devirtualizedCount.breakdown(),
+		DevirtualizedWeight: r.devirtualizedWeight.breakdown(),
+
+		DevirtualizedInlinedWeight: r.devirtualizedInlinedWeight.breakdown(),
+	}
+	if r.classes != nil {
+		s.Classes = make(map[string]Summary, len(r.classes))
+		for label, c := range r.classes {
+			s.Classes[label] = c.Summary()
+		}
+	}
+	return s
+}
+
+// loadTemplate returns the -template report template, or the built-in one.
+//
+// In addition to the Result, templates may use these functions:
+//
+//	sections        the names of the sections selected by -sections
+//	section NAME    the text of the named section
+//	pct N D         100*N/D
+//	units N         weight N, labeled with -unit
+func loadTemplate(selected []section) (*template.Template, error) {
+	text := defaultTemplate
+	if *templateFlag != "" {
+		b, err := os.ReadFile(*templateFlag)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	funcs := template.FuncMap{
+		"sections": func() []string {
+			names := make([]string, 0, len(selected))
+			for _, s := range selected {
+				names = append(names, s.name)
+			}
+			return names
+		},
+		"section": func(name string) (string, error) {
+			for _, s := range sections {
+				if s.name == name {
+					r := templateResult
+					if devirtSections[name] && !r.devirtDetail() {
+						return "", nil
+					}
+					var buf bytes.Buffer
+					s.print(&buf, r)
+					return buf.String(), nil
+				}
+			}
+			return "", fmt.Errorf("unknown section %q", name)
+		},
+		"pct":   pct,
+		"units": units,
+	}
+	return template.New("report").Funcs(funcs).Parse(text)
+}
+
+// templateResult is the Result being formatted by execTemplate, for the
+// section template function.
+var templateResult *Result
+
+// execTemplate writes the report for r formatted with t.
+func execTemplate(w io.Writer, t *template.Template, r *Result) error {
+	templateResult = r
+	defer func() { templateResult = nil }()
+	return t.Execute(w, r)
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+)
+
+var test2json = flag.Bool("test2json", false, "read input in the go test -json format, analyzing the output of its events")
+
+// test2jsonReader reads the output carried by a stream of go test -json
+// events. A line of output may be split across several events, so the
+// output is reassembled into a stream before it is split into lines again.
+type test2jsonReader struct {
+	br  *bufio.Reader
+	buf []byte
+	err error
+}
+
+func newTest2JSONReader(in io.Reader) io.Reader {
+	return &test2jsonReader{br: bufio.NewReader(in)}
+}
+
+func (t *test2jsonReader) Read(p []byte) (int, error) {
+	for len(t.buf) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		var line []byte
+		line, t.err = t.br.ReadBytes('\n')
+		if len(line) > 0 {
+			t.buf = unwrapEvent(line)
+		}
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
+
+// unwrapEvent returns the output carried by a go test -json event line.
+// Lines that are not events, such as compiler output interleaved with the
+// events, are returned as is.
+func unwrapEvent(line []byte) []byte {
+	var ev struct {
+		Action string
+		Output string
+	}
+	if err := json.Unmarshal(line, &ev); err != nil || ev.Action == "" {
+		return line
+	}
+	switch ev.Action {
+	case "output", "build-output":
+		return []byte(ev.Output)
+	}
+	return nil
+}
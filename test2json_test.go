@@ -0,0 +1,63 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// A call stat line may be split across several go test -json output
+// events, and must be reassembled before it is parsed.
+func TestReadStatsTest2JSONSplitLine(t *testing.T) {
+	defer func(v bool) { *test2json = v }(*test2json)
+	*test2json = true
+
+	want := CallStat{
+		Pkg:           "example.com/foo",
+		Pos:           "/src/foo.go:10:5",
+		Caller:        "foo.F",
+		Interface:     true,
+		Weight:        100,
+		Hottest:       "bar.(*T).M",
+		HottestWeight: 90,
+		Devirtualized: "bar.(*T).M",
+
+		DevirtualizedWeight: 90,
+	}
+	line, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := len(line) / 2
+
+	var in strings.Builder
+	for _, ev := range []struct{ Action, Output string }{
+		{"start", ""},
+		{"output", "# example.com/foo\n"},
+		{"output", string(line[:half])},
+		{"output", string(line[half:]) + "\n"},
+		{"pass", ""},
+	} {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in.Write(b)
+		in.WriteByte('\n')
+	}
+
+	r, err := readStats(strings.NewReader(in.String()))
+	if err != nil {
+		t.Fatalf("readStats: %v", err)
+	}
+	if len(r.Stats) != 1 {
+		t.Fatalf("got %d stats, want 1 (skipped %d lines)", len(r.Stats), r.Parse.Skipped)
+	}
+	if r.Stats[0] != want {
+		t.Errorf("got %+v, want %+v", r.Stats[0], want)
+	}
+}
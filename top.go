@@ -0,0 +1,301 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sortedByHottest returns a copy of stats sorted by increasing
+// HottestWeight. The input is left untouched so that other sections see the
+// original input order.
+func sortedByHottest(stats []CallStat) []CallStat {
+	return sortedBy(stats, hottestWeightOf)
+}
+
+func hottestWeightOf(s CallStat) int64 { return s.HottestWeight }
+
+var tiebreak = flag.String("tiebreak", "", "order callsites with equal weight in top-N lists by `key` before package and position; devirt lists devirtualized callsites first")
+
+// sortedBy returns a copy of stats sorted by increasing key.
+func sortedBy(stats []CallStat, key func(CallStat) int64) []CallStat {
+	stats = append([]CallStat(nil), stats...)
+	sort.Slice(stats, func(i, j int) bool {
+		if ki, kj := key(stats[i]), key(stats[j]); ki != kj {
+			return ki < kj
+		}
+		// Lists are printed in decreasing order, so devirtualized
+		// callsites sort last to be listed first.
+		if di, dj := stats[i].Devirtualized != "", stats[j].Devirtualized != ""; *tiebreak == "devirt" && di != dj {
+			return dj
+		}
+		if stats[i].Pkg != stats[j].Pkg {
+			return stats[i].Pkg < stats[j].Pkg
+		}
+		return stats[i].Pos < stats[j].Pos
+	})
+	return stats
+}
+
+// topKey is a way of ranking callsites for a top-N list.
+type topKey struct {
+	// title describes the list, as in "Top N <title>".
+	title string
+	// weight ranks callsites, heaviest first.
+	weight func(CallStat) int64
+	// keep reports whether an indirect callsite is eligible for the list.
+	keep func(CallStat) bool
+}
+
+var topKeys = map[string]topKey{
+	"hottest": {
+		title:  "hottest indirect calls",
+		weight: hottestWeightOf,
+	},
+	"weight": {
+		title:  "indirect calls by weight",
+		weight: func(s CallStat) int64 { return s.Weight },
+	},
+	"missed": {
+		title:  "hottest non-devirtualized indirect calls",
+		weight: hottestWeightOf,
+		keep:   func(s CallStat) bool { return s.Devirtualized == "" },
+	},
+}
+
+func topKeyNames() []string {
+	names := make([]string, 0, len(topKeys))
+	for name := range topKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// topSpec requests a top-N list of count callsites ranked by key.
+type topSpec struct {
+	key   string
+	count int // < 0 for no limit
+
+	// If > 0, the list ends once it covers this percentage of indirect
+	// hottest weight.
+	fraction float64
+}
+
+// topSpecs is a repeatable flag of KEY[:COUNT] top-N list specs.
+type topSpecs []topSpec
+
+func (t *topSpecs) String() string {
+	var parts []string
+	for _, s := range *t {
+		parts = append(parts, fmt.Sprintf("%s:%d", s.key, s.count))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t *topSpecs) Set(v string) error {
+	key, count, hasCount := strings.Cut(v, ":")
+	if _, ok := topKeys[key]; !ok {
+		return fmt.Errorf("unknown key %q (want one of %s)", key, strings.Join(topKeyNames(), ", "))
+	}
+	spec := topSpec{key: key, count: defaultTopCount}
+	if hasCount {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return fmt.Errorf("bad count %q", count)
+		}
+		spec.count = n
+	}
+	*t = append(*t, spec)
+	return nil
+}
+
+const defaultTopCount = 100
+
+var (
+	tops        topSpecs
+	topFraction = flag.Float64("top-fraction", 0, "instead of -top, print the hottest indirect calls until they cover this `percent` of indirect hottest weight")
+)
+
+func init() {
+	flag.Var(&tops, "top", "print a top-N list of indirect calls as `KEY[:N]`, where KEY is hottest, weight, or missed; may be repeated (default hottest:100)")
+}
+
+// printTopN prints each top-N list requested with -top.
+func printTopN(w io.Writer, r *Result) {
+	specs := tops
+	switch {
+	case *topFraction > 0:
+		specs = topSpecs{{key: "hottest", count: -1, fraction: *topFraction}}
+	case len(specs) == 0:
+		specs = topSpecs{{key: "hottest", count: defaultTopCount}}
+	}
+	for _, spec := range specs {
+		printTop(w, r, spec)
+	}
+}
+
+// selectTop returns the callsites of the top-N list for spec, in order.
+func selectTop(r *Result, spec topSpec) []CallStat {
+	key, topCount := topKeys[spec.key], spec.count
+	hottestWeight := &r.hottestWeight
+	indirectHottestWeight := hottestWeight.indirectFunc + hottestWeight.indirectMethod
+
+	stats := sortedBy(r.Stats, key.weight)
+	var top []CallStat
+	var topHottestWeight int64
+	for i := len(stats) - 1; i >= 0 && (topCount < 0 || len(top) < topCount); i-- {
+		if spec.fraction > 0 && pct(topHottestWeight, indirectHottestWeight) >= spec.fraction {
+			break
+		}
+		s := stats[i]
+		if s.Direct {
+			continue
+		}
+		if key.keep != nil && !key.keep(s) {
+			continue
+		}
+		top = append(top, s)
+		topHottestWeight += s.HottestWeight
+	}
+	return top
+}
+
+var compactTop = flag.Bool("compact-top", false, "print each top-N callsite on a single line, with a count of its inlined calls in place of the list")
+
+var inlineDepth = flag.Bool("inline-depth", false, "show the inlining depth, the number of calls inlined at its position, of each top-N callsite; with -compact-top, also list the inlined chain")
+
+// inlineChain formats the calls inlined at pos in inlining order.
+func inlineChain(r *Result, pos string) string {
+	return strings.Join(r.Inlined[pos], " -> ")
+}
+
+var pretty = flag.Bool("pretty", false, "align top-N columns to the longest caller and callee names rather than a fixed width")
+
+func printTop(w io.Writer, r *Result, spec topSpec) {
+	key, topCount := topKeys[spec.key], spec.count
+	weight, hottestWeight := &r.weight, &r.hottestWeight
+	indirectHottestWeight := hottestWeight.indirectFunc + hottestWeight.indirectMethod
+	if spec.fraction > 0 {
+		fmt.Fprintf(w, "\nTop %s covering %.2f%% of indirect hottest weight:\n", key.title, spec.fraction)
+	} else {
+		fmt.Fprintf(w, "\nTop %d %s:\n", topCount, key.title)
+	}
+
+	top := selectTop(r, spec)
+	callerWidth, calleeWidth := 40, 40
+	if *pretty {
+		callerWidth, calleeWidth = 0, 0
+		for _, s := range top {
+			callerWidth = max(callerWidth, len(s.Caller))
+			calleeWidth = max(calleeWidth, len(s.Hottest))
+		}
+	}
+
+	var topWeight, topHottestWeight int64
+	var devirtCount, devirtWeight int64
+	for _, s := range top {
+		spec := "NOT Devirtualized"
+		specExtra := ""
+		if !r.devirtDetail() {
+			spec = "          unknown"
+		} else if s.Devirtualized != "" {
+			spec = "    Devirtualized"
+			if s.Devirtualized != s.Hottest {
+				specExtra = fmt.Sprintf("\t(devirtualized to %s weight %s)", s.Devirtualized, units(s.DevirtualizedWeight))
+			}
+		}
+		typ := "interface"
+		if !s.Interface {
+			typ = " function"
+		}
+		// Cumulative share of indirect hottest weight covered through
+		// this row.
+		cumulative := pct(topHottestWeight+s.HottestWeight, indirectHottestWeight)
+		depth := len(r.Inlined[s.Pos])
+		if *compactTop {
+			chain := ""
+			if *inlineDepth && depth > 0 {
+				chain = fmt.Sprintf(" (%s)", inlineChain(r, s.Pos))
+			}
+			fmt.Fprintf(w, "\t%s %s %-*s -> %-*s %8s %6.2f%% %6.2f%% cum %3d inlined%s\t%s%s\n", spec, typ, callerWidth, s.Caller, calleeWidth, s.Hottest, units(s.HottestWeight), pct(s.HottestWeight, s.Weight), cumulative, depth, chain, displayPos(s.Pos), moduleTag(s.Pkg))
+		} else {
+			// Efficiency: how much of the callsite weight the
+			// devirtualization captured.
+			efficiency := ""
+			if s.Devirtualized != "" {
+				efficiency = fmt.Sprintf(", %.2f%% devirtualized", pct(s.DevirtualizedWeight, s.Weight))
+			}
+			extra := ""
+			if s.NumCallees > 0 {
+				extra = fmt.Sprintf(", %d callees", s.NumCallees)
+			}
+			if *inlineDepth {
+				extra += fmt.Sprintf(", inlining depth %d", depth)
+			}
+			fmt.Fprintf(w, "\t(%s) (%s) %-*s -> %-*s (weight %s, %.2f%% of callsite weight%s%s, %.2f%% cumulative)%s\t%s%s\n", spec, typ, callerWidth, s.Caller, calleeWidth, s.Hottest, units(s.HottestWeight), pct(s.HottestWeight, s.Weight), efficiency, extra, cumulative, specExtra, displayPos(s.Pos), moduleTag(s.Pkg))
+			for _, s := range r.Inlined[s.Pos] {
+				fmt.Fprintf(w, "\t\tinlined %s\n", s)
+			}
+			for _, s := range r.NotInlined[s.Pos] {
+				fmt.Fprintf(w, "\t\tnot inlined %s\n", s)
+			}
+		}
+
+		topWeight += s.Weight
+		topHottestWeight += s.HottestWeight
+		if s.Devirtualized != "" {
+			devirtCount++
+			devirtWeight += s.DevirtualizedWeight
+		}
+	}
+	// A short list is complete, not truncated; say so.
+	short := topCount >= 0 && len(top) < topCount
+	if topCount < 0 {
+		topCount = len(top)
+	}
+	fmt.Fprintf(w, "Top %d weight: %s (%.2f%% of indirect weight)\n", topCount, units(topWeight), pct(topWeight, weight.indirectFunc+weight.indirectMethod))
+	fmt.Fprintf(w, "Top %d hottest weight: %s (%.2f%% of indirect hottest weight)\n", topCount, units(topHottestWeight), pct(topHottestWeight, indirectHottestWeight))
+	if r.devirtDetail() {
+		fmt.Fprintf(w, "Top %d devirtualized: %d of %d calls (%.2f%%), weight %s (%.2f%% of top %d weight)\n", topCount, devirtCount, len(top), pct(devirtCount, int64(len(top))), units(devirtWeight), pct(devirtWeight, topWeight), topCount)
+	}
+	switch {
+	case short && key.keep != nil:
+		fmt.Fprintf(w, "(only %d indirect callsites qualify for this list)\n", len(top))
+	case short:
+		fmt.Fprintf(w, "(only %d indirect callsites present)\n", len(top))
+	}
+}
+
+var topByPackage = flag.Int("top-by-package", 0, "print the `N` hottest indirect calls of each package, heaviest package first")
+
+// printTopByPackage prints a top-N list for each package, with percentages
+// relative to the package rather than the whole program.
+func printTopByPackage(w io.Writer, r *Result) {
+	n := *topByPackage
+	if n <= 0 {
+		n = defaultTopCount
+	}
+	groups := groupIndirect(r.Stats, pkgOf)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].weight > groups[j].weight
+	})
+
+	byPkg := make(map[string][]CallStat)
+	for _, s := range r.Stats {
+		byPkg[s.Pkg] = append(byPkg[s.Pkg], s)
+	}
+	for _, g := range groups {
+		p := &Result{Stats: byPkg[g.name], Inlined: r.Inlined, NotInlined: r.NotInlined, Parse: r.Parse}
+		p.summarize()
+		fmt.Fprintf(w, "\nPackage %s%s (weight %s, %d indirect calls):", g.name, moduleTag(g.name), units(g.weight), g.calls)
+		printTop(w, p, topSpec{key: "hottest", count: n})
+	}
+}
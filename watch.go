@@ -0,0 +1,98 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	watch         = flag.Bool("watch", false, "with -input, rerun the analysis whenever the input file changes")
+	watchInterval = flag.Duration("watch-interval", 500*time.Millisecond, "how often -watch polls the input file")
+)
+
+// watchInput calls analyze once, then again each time the -input file
+// changes, until the input can no longer be stat'd.
+//
+// Changes are detected by polling the file's size and modification time. A
+// change is only acted upon once the file has stopped changing for a full
+// poll interval, so a log that is still being written isn't analyzed half
+// way through.
+func watchInput(analyze func() error) error {
+	if *inputFlag == "" {
+		return errors.New("-watch requires -input")
+	}
+	if isURL(*inputFlag) {
+		return errors.New("-watch requires a local -input file")
+	}
+
+	type state struct {
+		size    int64
+		modTime time.Time
+	}
+	stat := func() (state, error) {
+		fi, err := os.Stat(*inputFlag)
+		if err != nil {
+			return state{}, err
+		}
+		return state{fi.Size(), fi.ModTime()}, nil
+	}
+
+	last, err := stat()
+	if err != nil {
+		return err
+	}
+	clear := clearsScreen()
+	for {
+		if clear {
+			fmt.Print("\033[H\033[2J")
+		}
+		if err := analyze(); err != nil {
+			// The input may be mid-rewrite; report and keep
+			// watching.
+			log.Print(err)
+		}
+
+		// Wait for a change, then for it to settle.
+		for {
+			time.Sleep(*watchInterval)
+			cur, err := stat()
+			if err != nil {
+				return err
+			}
+			if cur == last {
+				continue
+			}
+			for {
+				last = cur
+				time.Sleep(*watchInterval)
+				cur, err = stat()
+				if err != nil {
+					return err
+				}
+				if cur == last {
+					break
+				}
+			}
+			break
+		}
+	}
+}
+
+// clearsScreen reports whether -watch should clear the screen before each
+// rerun: only when a text report is printed to a terminal, so that the
+// escape sequence doesn't corrupt machine-readable output or a file.
+func clearsScreen() bool {
+	if *format != "text" || *oneline || *outputDir != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}